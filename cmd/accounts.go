@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// accountError is a failure that is explained by the state of the account, such as a suspended or protected account.
+// These failures are not retried, since trying again will not succeed until the account changes.
+type accountError struct {
+	state string
+	err   error
+}
+
+func (e *accountError) Error() string {
+	return fmt.Sprintf("account is %s: %s", e.state, e.err)
+}
+
+func (e *accountError) Unwrap() error {
+	return e.err
+}
+
+// accountStateOf returns the account state that explains err, if there is one.
+func accountStateOf(err error) (string, bool) {
+	var accountErr *accountError
+	if errors.As(err, &accountErr) {
+		return accountErr.state, true
+	}
+	return "", false
+}
+
+// errProfileUnavailable is returned for a profile the scraper could not get without saying why.  Twitter answers the same way
+// for accounts that do not exist and accounts it does not show, so the state of the account has to be confirmed by its id.
+var errProfileUnavailable = errors.New("profile is unavailable")
+
+// classifyProfileError turns the errors the scraper returns for a profile into account errors.
+// The scraper passes twitter's messages on, e.g. "Authorization: User has been suspended. (63)" or "User 'handle' not found".
+// "either @handle does not exist or is private" does not say which, so it is returned as errProfileUnavailable instead.
+func classifyProfileError(err error) error {
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "suspended"):
+		return &accountError{state: models.AccountSuspended, err: err}
+	case strings.Contains(message, "does not exist or is private"):
+		return fmt.Errorf("%w: %s", errProfileUnavailable, err)
+	case strings.Contains(message, "not found"), strings.Contains(message, "does not exist"):
+		return &accountError{state: models.AccountDeleted, err: err}
+	}
+	return err
+}
+
+// apiError is an entry of the "errors" array of a v2 api response.
+type apiError struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Type   string `json:"type"`
+}
+
+// classifyAPIError returns the account error for a v2 api response about a user, or nil if the response does not say anything about the account.
+// Only the errors of the response are used: protected accounts answer with a not-authorized error, suspended accounts with an error mentioning
+// the suspension, and deleted accounts with a resource-not-found error.  A bare 401 or 403 is about the token, not the account.
+func classifyAPIError(body []byte) error {
+	var response struct {
+		Errors []apiError `json:"errors"`
+	}
+	json.Unmarshal(body, &response)
+
+	for _, apiErr := range response.Errors {
+		err := fmt.Errorf("%s: %s", apiErr.Title, apiErr.Detail)
+		switch {
+		case strings.Contains(strings.ToLower(apiErr.Detail), "suspended"):
+			return &accountError{state: models.AccountSuspended, err: err}
+		case strings.HasSuffix(apiErr.Type, "not-authorized-for-resource"):
+			return &accountError{state: models.AccountProtected, err: err}
+		case strings.HasSuffix(apiErr.Type, "resource-not-found"):
+			return &accountError{state: models.AccountDeleted, err: err}
+		}
+	}
+	return nil
+}
+
+// updateAccountState stores the account state of a user and logs when it changed.
+// An account that was renamed stays marked as renamed while it is active, so the rename stays visible on the users list.
+func (app *application) updateAccountState(userID int64, handle string, state string) {
+	if state == models.AccountActive {
+		current, err := models.GetAccountState(app.connection, userID)
+		if err == nil && current == models.AccountRenamed {
+			return
+		}
+	}
+
+	changed, err := models.SetAccountState(app.connection, userID, state)
+	if err != nil {
+		app.errorLog.Printf("Error storing account state of %s: %s", handle, err)
+		return
+	}
+	if changed {
+		app.infoLog.Printf("Account %s is now %s", handle, state)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// Size of the profile history charts, in SVG user units.
+const (
+	chartWidth  = 600
+	chartHeight = 120
+)
+
+// chartSeries is a line chart of one count over time, drawn server side as SVG since the content security policy does not allow scripts.
+// Points is the value of the points attribute of the SVG polyline.
+type chartSeries struct {
+	Label  string
+	Points string
+	Min    int
+	Max    int
+	Latest int
+	From   time.Time
+	To     time.Time
+	Width  int
+	Height int
+}
+
+// profileCharts returns the follower, following and tweet count charts of a user's profile snapshots.
+// Each chart has its own scale.  Returns nil if there are fewer than two snapshots, since a single point is not a line.
+func profileCharts(snapshots []models.UserSnapshot) []chartSeries {
+	if len(snapshots) < 2 {
+		return nil
+	}
+
+	times := make([]time.Time, len(snapshots))
+	followers := make([]int, len(snapshots))
+	following := make([]int, len(snapshots))
+	tweets := make([]int, len(snapshots))
+	for i, snapshot := range snapshots {
+		times[i] = snapshot.CollectedAt
+		followers[i] = snapshot.Followers
+		following[i] = snapshot.Following
+		tweets[i] = snapshot.Tweets
+	}
+
+	return []chartSeries{
+		newChartSeries("Followers", times, followers),
+		newChartSeries("Following", times, following),
+		newChartSeries("Tweets", times, tweets),
+	}
+}
+
+// newChartSeries scales the values to the chart.  Time runs left to right and the lowest value is at the bottom.
+// A series where every value is the same is drawn as a flat line in the middle.
+func newChartSeries(label string, times []time.Time, values []int) chartSeries {
+	series := chartSeries{
+		Label:  label,
+		Min:    values[0],
+		Max:    values[0],
+		Latest: values[len(values)-1],
+		From:   times[0],
+		To:     times[len(times)-1],
+		Width:  chartWidth,
+		Height: chartHeight,
+	}
+	for _, value := range values {
+		if value < series.Min {
+			series.Min = value
+		}
+		if value > series.Max {
+			series.Max = value
+		}
+	}
+
+	span := series.To.Sub(series.From)
+	points := make([]string, len(values))
+	for i, value := range values {
+		x := 0.0
+		if span > 0 {
+			x = float64(times[i].Sub(series.From)) / float64(span) * chartWidth
+		}
+		y := chartHeight / 2.0
+		if series.Max > series.Min {
+			y = chartHeight - float64(value-series.Min)/float64(series.Max-series.Min)*chartHeight
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	series.Points = strings.Join(points, " ")
+	return series
+}
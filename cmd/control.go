@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// jobControl holds the admin controls of the workers: which job kinds are paused, and how to cancel each running job.
+// Workers check it between pages and between users, so a pause or cancel takes effect without losing the work done so far.
+type jobControl struct {
+	mu sync.Mutex
+	//a kind is paused while it has a channel here.  The channel is closed on resume to wake up waiting workers.
+	paused map[string]chan struct{}
+	//cancels the context of a running job, keyed by job ID
+	running map[int64]context.CancelFunc
+}
+
+// newJobControl creates a jobControl with every kind running.
+func newJobControl() *jobControl {
+	return &jobControl{
+		paused:  make(map[string]chan struct{}),
+		running: make(map[int64]context.CancelFunc),
+	}
+}
+
+// pause pauses a job kind.  Pausing a paused kind does nothing.
+func (c *jobControl) pause(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.paused[kind]; !ok {
+		c.paused[kind] = make(chan struct{})
+	}
+}
+
+// resume resumes a paused job kind and wakes up everything waiting on it.
+func (c *jobControl) resume(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if resumed, ok := c.paused[kind]; ok {
+		close(resumed)
+		delete(c.paused, kind)
+	}
+}
+
+// isPaused reports whether a job kind is paused.
+func (c *jobControl) isPaused(kind string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.paused[kind]
+	return ok
+}
+
+// wait blocks while a job kind is paused.  Returns ctx.Err() if ctx is cancelled first.
+func (c *jobControl) wait(ctx context.Context, kind string) error {
+	c.mu.Lock()
+	resumed, ok := c.paused[kind]
+	c.mu.Unlock()
+	if !ok {
+		return ctx.Err()
+	}
+
+	select {
+	case <-resumed:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track registers the cancel function of a running job.
+func (c *jobControl) track(jobID int64, cancel context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running[jobID] = cancel
+}
+
+// untrack removes a job that is no longer running.
+func (c *jobControl) untrack(jobID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.running, jobID)
+}
+
+// cancel cancels the context of a running job.  Returns false if the job is not running.
+func (c *jobControl) cancel(jobID int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cancel, ok := c.running[jobID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// maxExpansionDepth is the deepest network that can be collected around a participant.
+const maxExpansionDepth = 2
+
+// expansionPolicy decides how far the network around a participant is collected, and which accounts in it are expanded.
+// At depth 0 only the followers and followings of participants are collected.  At depth 1 the follows between the accounts around a participant
+// are collected too.  At depth 2 the complete follower and following lists of the accounts around a participant are collected,
+// together with the follows between the accounts those lists add.
+type expansionPolicy struct {
+	depth int
+	//only accounts that look like a person are expanded
+	personsOnly bool
+	//only accounts that follow at least this many participants are expanded, 0 expands every account
+	minParticipants int
+}
+
+// parseExpansionFilter parses the comma separated filters of an expansion policy: "persons", and "participants=N".
+// An empty string or "all" expands every account.
+func parseExpansionFilter(policy *expansionPolicy, filters string) error {
+	for _, filter := range strings.Split(filters, ",") {
+		filter = strings.TrimSpace(filter)
+		key, value, _ := strings.Cut(filter, "=")
+		switch key {
+		case "", "all":
+		case "persons":
+			policy.personsOnly = true
+		case "participants":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return fmt.Errorf("expected participants=N with N at least 1, got %q", filter)
+			}
+			policy.minParticipants = count
+		default:
+			return fmt.Errorf("unknown filter %q", filter)
+		}
+	}
+	return nil
+}
+
+// expands reports whether the accounts hop follows away from a participant are expanded at all.
+func (p expansionPolicy) expands(hop int) bool {
+	return hop <= p.depth
+}
+
+// collectsLists reports whether the complete follower and following lists of accounts hop follows away from a participant are collected,
+// instead of only the follows to accounts that are already in the database.
+func (p expansionPolicy) collectsLists(hop int) bool {
+	return hop < p.depth
+}
+
+// expandable checks an account against the filters of the expansion policy.  If the account is not expanded, the reason is returned.
+func (app *application) expandable(user *models.User) (bool, string, error) {
+	policy := app.expansion
+	if policy.personsOnly && !user.IsPerson {
+		return false, "is not a person", nil
+	}
+	if policy.minParticipants > 0 {
+		count, err := models.CountFollowedParticipants(app.connection, user.ID)
+		if err != nil {
+			return false, "", err
+		}
+		if count < policy.minParticipants {
+			return false, fmt.Sprintf("follows %d of the %d participants needed", count, policy.minParticipants), nil
+		}
+	}
+	return true, "", nil
+}
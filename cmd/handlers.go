@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -16,18 +18,22 @@ type userViewForm struct {
 	Handle    string `form:"handle"`
 	School    string `form:"school"`
 	StartDate string `form:"start-date"`
+	EndDate   string `form:"end-date"`
 	Follows   bool   `form:"follows"`
 	Content   bool   `form:"content"`
 	Cohort    string `form:"cohort"`
+	limitFields
 	validation.Validator
 }
 type userAddForm struct {
 	Handle    string `form:"handle"`
 	School    string `form:"school"`
 	StartDate string `form:"start-date"`
+	EndDate   string `form:"end-date"`
 	Follows   bool   `form:"follows"`
 	Content   bool   `form:"content"`
 	Cohort    string `form:"cohort"`
+	limitFields
 	validation.Validator
 }
 
@@ -42,6 +48,15 @@ type schoolAddForm struct {
 	validation.Validator
 }
 
+// scheduleForm is the form to add a schedule on the dashboard.  An empty School or Cohort matches every school or cohort.
+type scheduleForm struct {
+	School string `form:"school"`
+	Cohort string `form:"cohort"`
+	Kind   string `form:"kind"`
+	Hours  string `form:"hours"`
+	validation.Validator
+}
+
 type adminSignupForm struct {
 	Name     string `form:"name"`
 	Email    string `form:"email"`
@@ -94,6 +109,24 @@ func (app *application) userView(w http.ResponseWriter, r *http.Request) {
 		School: school.Name,
 		Cohort: strconv.Itoa(student.Cohort),
 	}
+	if student.StartDate != nil {
+		form.StartDate = student.StartDate.Format("2006-01-02")
+	}
+	if student.EndDate != nil {
+		form.EndDate = student.EndDate.Format("2006-01-02")
+	}
+	//shows the participant's own limits, or the limits of their cohort if they have none
+	form.limitFields = limitFieldsFrom(student.Limits, limitScopeParticipant)
+	if student.Limits.Empty() {
+		cohortLimits, err := models.GetCohortFollowLimits(app.connection, student.SchoolID, student.Cohort)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if !cohortLimits.Empty() {
+			form.limitFields = limitFieldsFrom(cohortLimits, limitScopeCohort)
+		}
+	}
 
 	//removes user's school from the slice of schools available
 	for i, s := range schools {
@@ -103,11 +136,56 @@ func (app *application) userView(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	snapshots, err := models.GetUserSnapshots(app.connection, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	coverage, err := models.GetFollowCoverage(app.connection, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tweetTypes, err := models.GetTweetTypeCounts(app.connection, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	retweeted, err := models.GetTweetNetwork(app.connection, user.ID, models.TweetRetweet)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	quoted, err := models.GetTweetNetwork(app.connection, user.ID, models.TweetQuote)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	recentTweets, err := models.GetUserTweets(app.connection, user.ID, recentTweetsShown)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	scores, err := models.GetUserScoreAverage(app.connection, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	data := &templateData{
 		UserViewPage: userViewPage{
-			CurrentUser: *user,
-			Schools:     schools,
-			Form:        form,
+			CurrentUser:  *user,
+			Schools:      schools,
+			Form:         form,
+			Charts:       profileCharts(snapshots),
+			Coverage:     coverage,
+			TweetTypes:   tweetTypes,
+			Retweeted:    retweeted,
+			Quoted:       quoted,
+			RecentTweets: recentTweets,
+			Scores:       scores,
 		},
 	}
 
@@ -139,16 +217,21 @@ func (app *application) userViewPost(w http.ResponseWriter, r *http.Request) {
 		Handle:    strings.TrimSpace(r.PostForm.Get("handle")),
 		School:    strings.TrimSpace(r.PostForm.Get("school")),
 		StartDate: strings.TrimSpace(r.PostForm.Get("startDate")),
+		EndDate:   strings.TrimSpace(r.PostForm.Get("endDate")),
 		Cohort:    strings.TrimSpace(r.PostForm.Get("cohort")),
 		Follows:   r.PostForm.Get("follows") == "true",
 		Content:   r.PostForm.Get("content") == "true",
 	}
+	form.limitFields = readLimitFields(r.PostForm)
 
 	form.CheckField(validation.ValidInt(form.Cohort), "cohort", "Cohort must be a number")
+	form.limitFields.check(&form.Validator)
 	form.CheckField(validation.NotEmpty(form.Handle), "handle", "Handle is required")
 	form.CheckField(validation.NotEmpty(form.School), "school", "School is required")
 	form.CheckField(validation.NotEmpty(form.StartDate), "start-date", "Start Date is required")
 	form.CheckField(validation.PermittedDate(form.StartDate), "start-date", "Start Date must be a valid date")
+	form.CheckField(form.EndDate == "" || validation.PermittedDate(form.EndDate), "end-date", "End Date must be a valid date")
+	form.CheckField(form.EndDate == "" || form.EndDate >= form.StartDate, "end-date", "End Date must not be before Start Date")
 
 	if !form.Valid() {
 		app.infoLog.Println("Errors found in form")
@@ -205,6 +288,21 @@ func (app *application) userViewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//stores the follow limits on the participant or their cohort before the profile job queues the followers and followings jobs
+	//limits set on the cohort clear the participant's own, which would otherwise still override them
+	if form.LimitScope == limitScopeCohort {
+		err = models.SetCohortFollowLimits(app.connection, schoolID, cohortInt, form.limits())
+		if err == nil {
+			err = models.SetStudentFollowLimits(app.connection, uid, models.FollowLimits{})
+		}
+	} else {
+		err = models.SetStudentFollowLimits(app.connection, uid, form.limits())
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	toScrape := &simplifiedUser{
 		ID:                  uid,
 		Username:            form.Handle,
@@ -213,11 +311,16 @@ func (app *application) userViewPost(w http.ResponseWriter, r *http.Request) {
 		ParticipantCohort:   cohortInt,
 		ParticipantSchoolID: schoolID,
 		StartDate:           startDate,
+		EndDate:             parseEndDate(form.EndDate),
 		ScrapeConnections:   form.Follows,
 		ScrapeContent:       form.Content,
 	}
 
-	app.profileChan <- toScrape
+	_, err = app.enqueueJob(models.JobProfile, toScrape.ID, toScrape)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	app.sessionManager.Put(r.Context(), "flash", "User updated successfully")
 
@@ -225,6 +328,16 @@ func (app *application) userViewPost(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// parseEndDate parses the optional end date of a participant form.  The whole end day is included in the study window,
+// an empty end date leaves the window open and is returned as the zero time.
+func parseEndDate(endDate string) time.Time {
+	parsed, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed.Add(24*time.Hour - time.Nanosecond)
+}
+
 func (app *application) users(w http.ResponseWriter, r *http.Request) {
 	Users, err := models.GetAllParticipants(app.connection)
 	if err != nil {
@@ -253,8 +366,11 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := &templateData{}
-	app.populateTemplateData(r, data)
+	data, err := app.dashboardData(r, scheduleForm{})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	app.renderTemplate(w, http.StatusOK, "dashboard.html", data)
 
@@ -297,17 +413,22 @@ func (app *application) userAddPost(w http.ResponseWriter, r *http.Request) {
 		Handle:    strings.TrimSpace(r.PostForm.Get("handle")),
 		School:    strings.TrimSpace(r.PostForm.Get("school")),
 		StartDate: strings.TrimSpace(r.PostForm.Get("start-date")),
+		EndDate:   strings.TrimSpace(r.PostForm.Get("end-date")),
 		Cohort:    strings.TrimSpace(r.PostForm.Get("cohort")),
 		Follows:   strings.TrimSpace(r.PostForm.Get("follows")) == "true",
 		Content:   strings.TrimSpace(r.PostForm.Get("content")) == "true",
 	}
+	form.limitFields = readLimitFields(r.PostForm)
 
 	form.CheckField(validation.NotEmpty(form.Handle), "handle", "Handle is required")
 	form.CheckField(validation.NotEmpty(form.School), "school", "School is required")
 	form.CheckField(validation.NotEmpty(form.StartDate), "start-date", "Start Date is required")
 	form.CheckField(validation.PermittedDate(form.StartDate), "start-date", "Start Date must be a valid date")
+	form.CheckField(form.EndDate == "" || validation.PermittedDate(form.EndDate), "end-date", "End Date must be a valid date")
+	form.CheckField(form.EndDate == "" || form.EndDate >= form.StartDate, "end-date", "End Date must not be before Start Date")
 	form.CheckField(validation.NotEmpty(form.Cohort), "cohort", "Cohort is required")
 	form.CheckField(validation.ValidInt(form.Cohort), "cohort", "Cohort must be a valid integer")
+	form.limitFields.check(&form.Validator)
 
 	//if there are any errors, render the form again with the field errors and repopulated fields
 	if !form.Valid() {
@@ -357,10 +478,26 @@ func (app *application) userAddPost(w http.ResponseWriter, r *http.Request) {
 		ParticipantCohort:   cohort,
 		ParticipantSchoolID: schoolID,
 		StartDate:           startDate,
+		EndDate:             parseEndDate(form.EndDate),
 	}
 
-	//sends the user to the scraper to scrape the user's profile
-	app.profileChan <- toScrape
+	//cohort limits are stored straight away, the limits of the participant are stored by the profile job once the participant is added
+	if form.LimitScope == limitScopeCohort {
+		err = models.SetCohortFollowLimits(app.connection, schoolID, cohort, form.limits())
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	} else {
+		toScrape.Limits = form.limits()
+	}
+
+	//queues the user for the scraper to scrape the user's profile
+	_, err = app.enqueueJob(models.JobProfile, toScrape.ID, toScrape)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	app.sessionManager.Put(r.Context(), "flash", "User added successfully")
 
@@ -439,7 +576,11 @@ func (app *application) schoolAddPost(w http.ResponseWriter, r *http.Request) {
 		SchoolInfo: toInsert,
 	}
 
-	app.profileChan <- toScrape
+	_, err := app.enqueueJob(models.JobProfile, 0, toScrape)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	app.sessionManager.Put(r.Context(), "flash", "School added successfully")
 
@@ -599,6 +740,476 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// dashboardData returns the template data of the dashboard.  Only admins can control the workers, so the controls are only loaded for them.
+func (app *application) dashboardData(r *http.Request, form scheduleForm) (*templateData, error) {
+	data := &templateData{}
+	app.populateTemplateData(r, data)
+	if !data.IsAdmin {
+		return data, nil
+	}
+
+	jobs, err := models.GetActiveJobs(app.connection, dashboardJobLimit)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := models.GetAllSchedules(app.connection)
+	if err != nil {
+		return nil, err
+	}
+	schools, err := models.GetAllSchools(app.connection)
+	if err != nil {
+		return nil, err
+	}
+
+	data.DashboardPage = dashboardPage{
+		Workers:       data.StatusData.Workers,
+		Schedules:     schedules,
+		ScheduleKinds: scheduleKinds,
+		Schools:       schools,
+		Form:          form,
+		Profiles:      app.profiles.stats(),
+	}
+	for _, job := range jobs {
+		data.DashboardPage.Jobs = append(data.DashboardPage.Jobs, activeJob{
+			Job:     job,
+			Subject: jobSubject(&job),
+		})
+	}
+	return data, nil
+}
+
+// schedulePost is a handler for the POST request to the /schedules endpoint.  It validates the form data and, if valid, adds a schedule.
+func (app *application) schedulePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	form := scheduleForm{
+		School: strings.TrimSpace(r.PostForm.Get("school")),
+		Cohort: strings.TrimSpace(r.PostForm.Get("cohort")),
+		Kind:   strings.TrimSpace(r.PostForm.Get("kind")),
+		Hours:  strings.TrimSpace(r.PostForm.Get("hours")),
+	}
+
+	validKind := false
+	for _, kind := range scheduleKinds {
+		validKind = validKind || form.Kind == kind
+	}
+	form.CheckField(validKind, "kind", "Collect must be one of the listed jobs")
+	form.CheckField(form.Cohort == "" || validation.ValidInt(form.Cohort), "cohort", "Cohort must be a valid integer")
+	form.CheckField(validation.NotEmpty(form.Hours), "hours", "Interval is required")
+	hours, err := strconv.Atoi(form.Hours)
+	form.CheckField(err == nil && hours > 0, "hours", "Interval must be a positive number of hours")
+
+	//if there are any errors, render the dashboard again with the field errors and repopulated fields
+	if !form.Valid() {
+		data, err := app.dashboardData(r, form)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.renderTemplate(w, http.StatusUnprocessableEntity, "dashboard.html", data)
+		return
+	}
+
+	schedule := &models.Schedule{
+		Kind:          form.Kind,
+		IntervalHours: hours,
+	}
+	if form.School != "" {
+		schoolID, err := models.GetSchoolIDByName(app.connection, form.School)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		schedule.SchoolID = &schoolID
+	}
+	if form.Cohort != "" {
+		cohort, _ := strconv.Atoi(form.Cohort)
+		schedule.Cohort = &cohort
+	}
+
+	err = models.InsertSchedule(app.connection, schedule)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Schedule added")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// scheduleDeletePost is a handler for the POST request to the /schedules/:id/delete endpoint.
+func (app *application) scheduleDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	err = models.DeleteSchedule(app.connection, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Schedule deleted")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// workerKind reads the job kind from the :kind parameter of a worker control route.  Returns false if it is not a known kind.
+func workerKind(r *http.Request) (string, bool) {
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+	for _, known := range jobKinds {
+		if kind == known {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// workerPausePost is a handler for the POST request to the /workers/:kind/pause endpoint.
+// The worker stops leasing jobs, and the running job waits at its next page or user.
+func (app *application) workerPausePost(w http.ResponseWriter, r *http.Request) {
+	kind, ok := workerKind(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	app.control.pause(kind)
+	app.infoLog.Printf("%s worker paused", kind)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Paused %s worker", kind))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// workerResumePost is a handler for the POST request to the /workers/:kind/resume endpoint.
+func (app *application) workerResumePost(w http.ResponseWriter, r *http.Request) {
+	kind, ok := workerKind(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	app.control.resume(kind)
+	app.infoLog.Printf("%s worker resumed", kind)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Resumed %s worker", kind))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// workerDrainPost is a handler for the POST request to the /workers/:kind/drain endpoint.  It cancels every queued job of the kind.
+func (app *application) workerDrainPost(w http.ResponseWriter, r *http.Request) {
+	kind, ok := workerKind(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	drained, err := models.DrainJobs(app.connection, kind)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.infoLog.Printf("%d queued %s jobs cancelled", drained, kind)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Cancelled %d queued %s jobs", drained, kind))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// jobCancelPost is a handler for the POST request to the /jobs/:id/cancel endpoint.
+// A queued job is cancelled straight away, a running job stops at its next page or user and keeps what it stored.
+func (app *application) jobCancelPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	cancelled, err := models.CancelQueuedJob(app.connection, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	//the job may have been leased since the page was loaded
+	if !cancelled {
+		cancelled = app.control.cancel(id)
+	}
+
+	if cancelled {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Cancelled job %d", id))
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Job %d is not queued or running", id))
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// failedJobs is a handler for the /jobs/failed endpoint.  It lists the dead-letter jobs with the error of every attempt.
+func (app *application) failedJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := models.GetFailedJobs(app.connection)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var failed []failedJob
+	for _, job := range jobs {
+		jobErrors, err := models.GetJobErrors(app.connection, job.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		failed = append(failed, failedJob{
+			Job:     job,
+			Subject: jobSubject(&job),
+			Errors:  jobErrors,
+		})
+	}
+
+	data := &templateData{
+		FailedJobsPage: failedJobsPage{
+			Jobs: failed,
+		},
+	}
+	app.populateTemplateData(r, data)
+
+	app.renderTemplate(w, http.StatusOK, "failedJobs.html", data)
+}
+
+// failedJobRequeuePost is a handler for the POST request to the /jobs/failed/:id/requeue endpoint.  It puts a dead-letter job back in the queue.
+func (app *application) failedJobRequeuePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	job, err := models.RequeueFailedJob(app.connection, id)
+	if errors.Is(err, models.ErrNotFound) {
+		app.notFound(w)
+		return
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.signalJob(job.Kind)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Requeued %s job for %s", job.Kind, jobSubject(job)))
+	http.Redirect(w, r, "/jobs/failed", http.StatusSeeOther)
+}
+
+// followChanges is the response of the /users/view/:id/follow-changes endpoint.
+type followChanges struct {
+	UserID           int64                `json:"user_id"`
+	From             time.Time            `json:"from"`
+	To               time.Time            `json:"to"`
+	GainedFollowers  []models.FollowEvent `json:"gained_followers"`
+	LostFollowers    []models.FollowEvent `json:"lost_followers"`
+	GainedFollowings []models.FollowEvent `json:"gained_followings"`
+	LostFollowings   []models.FollowEvent `json:"lost_followings"`
+}
+
+// userFollowChanges is a handler for the GET request to the /users/view/:id/follow-changes endpoint.  It returns the followers and followings
+// a user gained and lost between the from and to query parameters (YYYY-MM-DD, both days included) as JSON.  By default it covers the last 30 days.
+func (app *application) userFollowChanges(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	uid, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	if !models.UserIDExists(app.connection, uid) {
+		app.notFound(w)
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := r.URL.Query().Get("to"); value != "" {
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	from := to.AddDate(0, 0, -30)
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if !from.Before(to) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	events, err := models.GetFollowEvents(app.connection, uid, from, to)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	changes := followChanges{
+		UserID:           uid,
+		From:             from,
+		To:               to,
+		GainedFollowers:  []models.FollowEvent{},
+		LostFollowers:    []models.FollowEvent{},
+		GainedFollowings: []models.FollowEvent{},
+		LostFollowings:   []models.FollowEvent{},
+	}
+	for _, event := range events {
+		switch {
+		case event.FolloweeID == uid && event.Event == models.FollowGained:
+			changes.GainedFollowers = append(changes.GainedFollowers, event)
+		case event.FolloweeID == uid && event.Event == models.FollowLost:
+			changes.LostFollowers = append(changes.LostFollowers, event)
+		case event.FollowerID == uid && event.Event == models.FollowGained:
+			changes.GainedFollowings = append(changes.GainedFollowings, event)
+		case event.FollowerID == uid && event.Event == models.FollowLost:
+			changes.LostFollowings = append(changes.LostFollowings, event)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(changes)
+	if err != nil {
+		app.errorLog.Println("Error writing follow changes:", err)
+	}
+}
+
+// tweetScores is a handler for the GET request to the /scores endpoint.  It shows the average sentiment and toxicity of the tweets
+// of each cohort and participant.
+func (app *application) tweetScores(w http.ResponseWriter, r *http.Request) {
+	cohorts, err := models.GetCohortScores(app.connection)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	participants, err := models.GetParticipantScores(app.connection)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := &templateData{
+		ScoresPage: scoresPage{
+			Cohorts:      cohorts,
+			Participants: participants,
+		},
+	}
+	app.populateTemplateData(r, data)
+
+	app.renderTemplate(w, http.StatusOK, "scores.html", data)
+}
+
+// sharedDomains is a handler for the GET request to the /domains endpoint.  It shows the domains the participants of each cohort link to most.
+func (app *application) sharedDomains(w http.ResponseWriter, r *http.Request) {
+	shares, err := models.GetCohortDomains(app.connection, sharedDomainsShown, ignoredDomains)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := &templateData{
+		DomainsPage: domainsPage{
+			Cohorts: groupCohortDomains(shares),
+			Ignored: ignoredDomains,
+		},
+	}
+	app.populateTemplateData(r, data)
+
+	app.renderTemplate(w, http.StatusOK, "domains.html", data)
+}
+
+// tweetThread is a handler for the GET request to the /tweets/thread/:id endpoint.  It shows the whole conversation a tweet belongs to,
+// nested from the root of the conversation, with the tweet marked.
+func (app *application) tweetThread(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	tweetID, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	conversationID, err := models.GetConversationID(app.connection, tweetID)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	tweets, err := models.GetConversation(app.connection, conversationID)
+	if errors.Is(err, models.ErrNotFound) {
+		app.notFound(w)
+		return
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := &templateData{
+		ThreadPage: threadPage{
+			TweetID: tweetID,
+			Root:    buildThread(tweets, tweetID),
+			Size:    len(tweets),
+		},
+	}
+	app.populateTemplateData(r, data)
+
+	app.renderTemplate(w, http.StatusOK, "thread.html", data)
+}
+
+// userTweetNetwork is a handler for the GET request to the /users/view/:id/tweet-network endpoint.  It returns the users whose tweets a user
+// retweeted or quoted as JSON, chosen with the type query parameter ("retweet" or "quote").
+func (app *application) userTweetNetwork(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	uid, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	if !models.UserIDExists(app.connection, uid) {
+		app.notFound(w)
+		return
+	}
+
+	tweetType := r.URL.Query().Get("type")
+	if tweetType != models.TweetRetweet && tweetType != models.TweetQuote {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	edges, err := models.GetTweetNetwork(app.connection, uid, tweetType)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if edges == nil {
+		edges = []models.TweetEdge{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(edges)
+	if err != nil {
+		app.errorLog.Println("Error writing tweet network:", err)
+	}
+}
+
 //isAdmin checks if the user is an admin (logged in)
 func (app *application) isAdmin(r *http.Request) bool {
 	return app.sessionManager.Exists(r.Context(), "admin_id")
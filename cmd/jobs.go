@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// jobPollInterval is how long an idle worker waits before checking the jobs table again when it has not been signalled.
+const jobPollInterval = 5 * time.Second
+
+// dashboardJobLimit is the number of running and queued jobs listed on the dashboard.
+const dashboardJobLimit = 50
+
+// jobKinds lists every kind of job that has a worker.
+var jobKinds = []string{models.JobProfile, models.JobTweets, models.JobFollowers, models.JobFollowings, models.JobConnections}
+
+// newJobSignals creates one signal channel per job kind.  The channels are buffered so signalling never blocks.
+func newJobSignals() map[string]chan struct{} {
+	signals := make(map[string]chan struct{})
+	for _, kind := range jobKinds {
+		signals[kind] = make(chan struct{}, 1)
+	}
+	return signals
+}
+
+// enqueueJob stores a job in the jobs table and wakes up the worker of that kind.  Payload is encoded as json.
+// userID is the user the job is about, or 0 if the user is not in the database yet.  Returns the ID of the job.
+func (app *application) enqueueJob(kind string, userID int64, payload any) (int64, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := models.InsertJob(app.connection, &models.Job{
+		Kind:    kind,
+		UserID:  userID,
+		Payload: encoded,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	app.signalJob(kind)
+	return id, nil
+}
+
+// signalJob wakes up the worker of a job kind if it is waiting for work.
+func (app *application) signalJob(kind string) {
+	select {
+	case app.jobSignals[kind] <- struct{}{}:
+	default:
+	}
+}
+
+// jobSubject returns the handle of the user a job is about, read from its payload.  Every job payload has a username.
+func jobSubject(job *models.Job) string {
+	var payload struct {
+		Username string `json:"username"`
+	}
+	err := json.Unmarshal(job.Payload, &payload)
+	if err != nil || payload.Username == "" {
+		return fmt.Sprintf("job %d", job.ID)
+	}
+	return payload.Username
+}
+
+// loadCheckpoint decodes the checkpoint of a job into v.  v is left untouched if the job has no checkpoint yet.
+func loadCheckpoint(job *models.Job, v any) error {
+	if job.Checkpoint == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(job.Checkpoint), v)
+}
+
+// saveCheckpoint encodes v as json and saves it as the checkpoint of a job.
+func (app *application) saveCheckpoint(job *models.Job, v any) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	job.Checkpoint = string(encoded)
+	return models.UpdateJobCheckpoint(app.connection, job.ID, job.Checkpoint)
+}
+
+// runJobs leases jobs of a kind from the jobs table one at a time and passes them to handle, until ctx is cancelled.
+// A job is marked done if handle returns nil, otherwise the error is recorded and the job is retried or dead-lettered by its retry policy.
+// A job that is interrupted by ctx is put back in the queue with its checkpoint, so it resumes on the next start.
+// A job cancelled from the dashboard is marked cancelled, and no job is leased while the kind is paused.
+func (app *application) runJobs(ctx context.Context, kind string, handle func(ctx context.Context, job *models.Job) error) {
+	status := app.status.worker(kind)
+	defer status.stop()
+
+	for ctx.Err() == nil {
+		//no new job is leased while the kind is paused
+		if app.control.isPaused(kind) {
+			status.pause()
+			app.control.wait(ctx, kind)
+			status.finish()
+			continue
+		}
+
+		job, err := models.LeaseJob(app.connection, kind)
+		if errors.Is(err, models.ErrNoJob) {
+			//waits until a job of this kind is enqueued, or the poll interval passes
+			select {
+			case <-app.jobSignals[kind]:
+			case <-time.After(jobPollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		if err != nil {
+			app.errorLog.Printf("Error leasing %s job: %s", kind, err)
+			select {
+			case <-time.After(jobPollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		//every job gets its own context so it can be cancelled from the dashboard
+		jobCtx, cancel := context.WithCancel(ctx)
+		app.control.track(job.ID, cancel)
+		status.start(jobSubject(job))
+		err = handle(jobCtx, job)
+		status.finish()
+		app.control.untrack(job.ID)
+		cancelled := jobCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		if cancelled {
+			app.infoLog.Printf("%s job %d cancelled", kind, job.ID)
+			err = models.CancelJob(app.connection, job.ID)
+		} else if err != nil && ctx.Err() != nil {
+			app.infoLog.Printf("%s job %d interrupted, requeueing", kind, job.ID)
+			err = models.RequeueJob(app.connection, job.ID)
+		} else if err != nil {
+			status.fail(err)
+			err = app.retryOrFail(job, err)
+		} else {
+			err = models.CompleteJob(app.connection, job.ID)
+		}
+		if err != nil {
+			app.errorLog.Printf("Error updating %s job %d: %s", kind, job.ID, err)
+		}
+	}
+}
+
+// resumeJobs requeues the jobs that were interrupted the last time the program stopped, and logs what is waiting in the queue.
+func (app *application) resumeJobs() error {
+	requeued, err := models.RequeueRunningJobs(app.connection)
+	if err != nil {
+		return err
+	}
+	app.infoLog.Printf("%d interrupted jobs requeued", requeued)
+
+	for _, kind := range jobKinds {
+		queued, err := models.CountJobs(app.connection, kind, models.JobQueued)
+		if err != nil {
+			return err
+		}
+		if queued > 0 {
+			app.infoLog.Printf("%d %s jobs queued", queued, kind)
+		}
+	}
+	return nil
+}
+
+// logShutdownSummary logs the jobs left in the queue when the program stops, and how many of them resume from a checkpoint.
+func (app *application) logShutdownSummary() {
+	for _, kind := range jobKinds {
+		queued, err := models.CountJobs(app.connection, kind, models.JobQueued)
+		if err != nil {
+			app.errorLog.Printf("Error counting %s jobs: %s", kind, err)
+			continue
+		}
+		checkpointed, err := models.CountCheckpointedJobs(app.connection, kind)
+		if err != nil {
+			app.errorLog.Printf("Error counting %s checkpoints: %s", kind, err)
+			continue
+		}
+		if queued > 0 {
+			app.infoLog.Printf("%d %s jobs left in the queue, %d resume from a checkpoint", queued, kind, checkpointed)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+	"github.com/rainbowriverrr/F3Ytwitter/internal/validation"
+)
+
+// defaultFollowLimit is the follow limit used when none is configured.
+const defaultFollowLimit = 1000
+
+// followLimits are the largest follower and following lists collected for a user, and the largest lists collected
+// for the accounts around a participant when their connections are scraped.
+type followLimits struct {
+	followers   int
+	followings  int
+	connections int
+}
+
+// overLimit checks if a list of count accounts is over a follow limit.  A list exactly at the limit is collected in full.
+func overLimit(count int, limit int) bool {
+	return count > limit
+}
+
+// followLimitsFromEnv reads the global follow limits from FOLLOWER_LIMIT, FOLLOWING_LIMIT and CONNECTION_LIMIT.
+// Limits that are not set are defaultFollowLimit.
+func followLimitsFromEnv(getenv func(string) string) (followLimits, error) {
+	limits := followLimits{defaultFollowLimit, defaultFollowLimit, defaultFollowLimit}
+	for name, limit := range map[string]*int{
+		"FOLLOWER_LIMIT":   &limits.followers,
+		"FOLLOWING_LIMIT":  &limits.followings,
+		"CONNECTION_LIMIT": &limits.connections,
+	} {
+		value := getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return limits, fmt.Errorf("invalid %s %q, expected a number that is not negative", name, value)
+		}
+		*limit = parsed
+	}
+	return limits, nil
+}
+
+// followLimitsFor returns the follow limits of a user.  Limits set on the participant win over the limits of their cohort,
+// which win over the global limits.
+func (app *application) followLimitsFor(userID int64) followLimits {
+	limits := app.followLimits
+	overrides, err := models.GetFollowLimits(app.connection, userID)
+	if err != nil {
+		app.errorLog.Printf("Error getting follow limits of user %d: %s", userID, err)
+		return limits
+	}
+	if overrides.Followers != nil {
+		limits.followers = *overrides.Followers
+	}
+	if overrides.Followings != nil {
+		limits.followings = *overrides.Followings
+	}
+	if overrides.Connections != nil {
+		limits.connections = *overrides.Connections
+	}
+	return limits
+}
+
+// Scopes of the follow limits of a participant form.
+const (
+	limitScopeParticipant = "participant"
+	limitScopeCohort      = "cohort"
+)
+
+// limitFields are the follow limit fields of the participant forms.  Empty limits are not set.
+// The limits apply to the participant, or to their whole cohort if LimitScope is "cohort".
+type limitFields struct {
+	FollowerLimit   string `form:"follower-limit"`
+	FollowingLimit  string `form:"following-limit"`
+	ConnectionLimit string `form:"connection-limit"`
+	LimitScope      string `form:"limit-scope"`
+}
+
+// readLimitFields reads the follow limit fields of a posted participant form.
+func readLimitFields(form url.Values) limitFields {
+	return limitFields{
+		FollowerLimit:   strings.TrimSpace(form.Get("follower-limit")),
+		FollowingLimit:  strings.TrimSpace(form.Get("following-limit")),
+		ConnectionLimit: strings.TrimSpace(form.Get("connection-limit")),
+		LimitScope:      strings.TrimSpace(form.Get("limit-scope")),
+	}
+}
+
+// limitFieldsFrom fills the follow limit fields of a participant form.
+func limitFieldsFrom(limits models.FollowLimits, scope string) limitFields {
+	format := func(limit *int) string {
+		if limit == nil {
+			return ""
+		}
+		return strconv.Itoa(*limit)
+	}
+	return limitFields{
+		FollowerLimit:   format(limits.Followers),
+		FollowingLimit:  format(limits.Followings),
+		ConnectionLimit: format(limits.Connections),
+		LimitScope:      scope,
+	}
+}
+
+// check validates the follow limit fields.
+func (f *limitFields) check(v *validation.Validator) {
+	for _, field := range []struct {
+		key   string
+		value string
+	}{
+		{"follower-limit", f.FollowerLimit},
+		{"following-limit", f.FollowingLimit},
+		{"connection-limit", f.ConnectionLimit},
+	} {
+		limit, err := strconv.Atoi(field.value)
+		v.CheckField(field.value == "" || (err == nil && limit >= 0), field.key, "Limit must be a number that is not negative")
+	}
+	v.CheckField(f.LimitScope == "" || f.LimitScope == limitScopeParticipant || f.LimitScope == limitScopeCohort, "limit-scope", "Limits must apply to the participant or the cohort")
+}
+
+// limits returns the follow limits of valid fields.
+func (f *limitFields) limits() models.FollowLimits {
+	parse := func(value string) *int {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil
+		}
+		return &limit
+	}
+	return models.FollowLimits{
+		Followers:   parse(f.FollowerLimit),
+		Followings:  parse(f.FollowingLimit),
+		Connections: parse(f.ConnectionLimit),
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	twitterscraper "github.com/n0madic/twitter-scraper"
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// ignoredDomains are left out of the domains shared by each cohort, links to them are quoted tweets and links within Twitter rather than sources.
+var ignoredDomains = []string{"twitter.com", "mobile.twitter.com", "t.co"}
+
+// sharedDomainsShown is how many domains are shown for each cohort.
+const sharedDomainsShown = 10
+
+// tweetLinks returns the links, photos and videos of a tweet.  Links that can not be parsed are skipped.
+func tweetLinks(tweet *twitterscraper.Tweet, tweetID int64) ([]*models.TweetURL, []*models.TweetMedia) {
+	var urls []*models.TweetURL
+	for _, link := range tweet.URLs {
+		domain := urlDomain(link)
+		if domain == "" {
+			continue
+		}
+		urls = append(urls, &models.TweetURL{
+			TweetID: tweetID,
+			URL:     link,
+			Domain:  domain,
+		})
+	}
+
+	//the scraper adds the preview of every video to the photos too, those are kept with their video instead
+	previews := make(map[string]bool)
+	for _, video := range tweet.Videos {
+		previews[video.Preview] = true
+	}
+
+	var media []*models.TweetMedia
+	for _, photo := range tweet.Photos {
+		if previews[photo] {
+			continue
+		}
+		media = append(media, &models.TweetMedia{
+			TweetID: tweetID,
+			Type:    models.MediaPhoto,
+			URL:     photo,
+		})
+	}
+	for _, video := range tweet.Videos {
+		if video.URL == "" {
+			continue
+		}
+		media = append(media, &models.TweetMedia{
+			TweetID: tweetID,
+			Type:    models.MediaVideo,
+			URL:     video.URL,
+			Preview: video.Preview,
+		})
+	}
+	return urls, media
+}
+
+// urlDomain returns the lower case host name of a link without "www.", or an empty string if the link has no host.
+func urlDomain(link string) string {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// cohortDomains are the domains the participants of a cohort link to most.
+type cohortDomains struct {
+	School  string
+	Cohort  int
+	Domains []models.DomainShare
+}
+
+// groupCohortDomains groups the domains shared by each cohort, in the order GetCohortDomains returns them.
+func groupCohortDomains(shares []models.DomainShare) []cohortDomains {
+	var cohorts []cohortDomains
+	for _, share := range shares {
+		last := len(cohorts) - 1
+		if last < 0 || cohorts[last].Cohort != share.Cohort || cohorts[last].Domains[0].SchoolID != share.SchoolID {
+			cohorts = append(cohorts, cohortDomains{School: share.School, Cohort: share.Cohort})
+			last++
+		}
+		cohorts[last].Domains = append(cohorts[last].Domains, share)
+	}
+	return cohorts
+}
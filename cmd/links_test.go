@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	twitterscraper "github.com/n0madic/twitter-scraper"
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+func TestTweetLinks(t *testing.T) {
+	video := twitterscraper.Video{ID: "5", Preview: "https://pbs.twimg.com/video.jpg", URL: "https://video.twimg.com/video.mp4"}
+
+	tests := []struct {
+		name      string
+		tweet     twitterscraper.Tweet
+		wantURLs  []*models.TweetURL
+		wantMedia []*models.TweetMedia
+	}{
+		{
+			name:  "links",
+			tweet: twitterscraper.Tweet{URLs: []string{"https://www.Example.com/a", "not a link"}},
+			wantURLs: []*models.TweetURL{
+				{TweetID: 1, URL: "https://www.Example.com/a", Domain: "example.com"},
+			},
+		},
+		{
+			name:  "photos",
+			tweet: twitterscraper.Tweet{Photos: []string{"https://pbs.twimg.com/a.jpg", "https://pbs.twimg.com/b.jpg"}},
+			wantMedia: []*models.TweetMedia{
+				{TweetID: 1, Type: models.MediaPhoto, URL: "https://pbs.twimg.com/a.jpg"},
+				{TweetID: 1, Type: models.MediaPhoto, URL: "https://pbs.twimg.com/b.jpg"},
+			},
+		},
+		{
+			//the scraper adds the preview of a video to the photos as well
+			name:  "video",
+			tweet: twitterscraper.Tweet{Photos: []string{video.Preview}, Videos: []twitterscraper.Video{video}},
+			wantMedia: []*models.TweetMedia{
+				{TweetID: 1, Type: models.MediaVideo, URL: video.URL, Preview: video.Preview},
+			},
+		},
+		{
+			name:  "photo and video",
+			tweet: twitterscraper.Tweet{Photos: []string{"https://pbs.twimg.com/a.jpg", video.Preview}, Videos: []twitterscraper.Video{video}},
+			wantMedia: []*models.TweetMedia{
+				{TweetID: 1, Type: models.MediaPhoto, URL: "https://pbs.twimg.com/a.jpg"},
+				{TweetID: 1, Type: models.MediaVideo, URL: video.URL, Preview: video.Preview},
+			},
+		},
+		{
+			name:  "video without url",
+			tweet: twitterscraper.Tweet{Photos: []string{video.Preview}, Videos: []twitterscraper.Video{{ID: "5", Preview: video.Preview}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, media := tweetLinks(&tt.tweet, 1)
+			if !reflect.DeepEqual(urls, tt.wantURLs) {
+				t.Errorf("got urls %+v, want %+v", urls, tt.wantURLs)
+			}
+			if !reflect.DeepEqual(media, tt.wantMedia) {
+				t.Errorf("got media %+v, want %+v", media, tt.wantMedia)
+			}
+		})
+	}
+}
+
+func TestURLDomain(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{link: "https://example.com/a?b=c", want: "example.com"},
+		{link: "https://www.Example.COM/", want: "example.com"},
+		{link: " http://news.example.org:8080/a ", want: "news.example.org"},
+		{link: "https://wwwexample.com", want: "wwwexample.com"},
+		{link: "example.com/a", want: ""},
+		{link: "://broken", want: ""},
+		{link: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := urlDomain(tt.link); got != tt.want {
+			t.Errorf("urlDomain(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
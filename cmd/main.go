@@ -8,6 +8,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"flag"
@@ -17,22 +21,35 @@ import (
 	"github.com/go-playground/form/v4"
 	pgxpool "github.com/jackc/pgx/v4/pgxpool"
 	godotenv "github.com/joho/godotenv"
-	twitterscraper "github.com/n0madic/twitter-scraper"
 	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+	"github.com/rainbowriverrr/F3Ytwitter/internal/scoring"
 	"github.com/rainbowriverrr/F3Ytwitter/internal/validation"
 )
 
+// followRequest asks a follow queue for the page of a user's followers or followings that starts at PageToken.
+// ctx is the context of the job that made the request, the page is abandoned when it is cancelled.
+// kind is the job kind that made the request, the queue holds the request while that kind is paused.
 type followRequest struct {
-	User     *models.SimpleRequest
-	upstream chan []*models.Follow
+	ctx       context.Context
+	kind      string
+	User      *models.SimpleRequest
+	PageToken string
+	upstream  chan followResult
 }
+
+// followResult is sent back on the upstream channel of a followRequest.  next is the token of the next page, err is set if the scrape failed.
+type followResult struct {
+	follows []*models.Follow
+	next    string
+	err     error
+}
+
 type connectionsRequest struct {
-	ID      int64
-	follows []*models.Follow `json:"follows"`
+	follows []*models.Follow
 	//expects: "followings" or "followers"
 	//"followings" means the slice of follows is the slice of followings
 	//"followers" means the slice of follows is the slice of followers
-	users string `json:'follower"`
+	users string
 }
 type simplifiedSchool struct {
 	Name          string `json:"name"`
@@ -54,45 +71,58 @@ type simplifiedUser struct {
 	ParticipantCohort   int               `json:"participantCohort"`
 	SchoolInfo          *simplifiedSchool `json:"schoolInfo"`
 	StartDate           time.Time         `json:"startDate"`
+	EndDate             time.Time         `json:"endDate"`
 	ScrapeConnections   bool              `json:"scrape_connections"`
 	ScrapeContent       bool              `json:"scrape_content"`
-	BackupID            int64             `json:"backup_id"`
+	//follow limits to store on the participant
+	Limits models.FollowLimits `json:"limits"`
 }
 
 // Application dependencies to be injected
 type application struct {
-	errorLog      *log.Logger
-	infoLog       *log.Logger
-	connection    *pgxpool.Pool
-	scraper       twitterscraper.Scraper
+	errorLog   *log.Logger
+	infoLog    *log.Logger
+	connection *pgxpool.Pool
+	//source of all twitter data used by the workers
+	source        TwitterSource
 	templateCache map[string]*template.Template
 	//currently, automatic form decoding not implemented
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
 	debug          bool
-	bearerToken    string
-	bearerToken2   string
 	apiKey         string
 	secretKey      string
-	followerClient http.Client
-	//expects simplifiedUser struct
-	profileChan     chan *simplifiedUser
-	followChan      chan *models.SimpleRequest
-	followerChan    chan *models.SimpleRequest
-	tweetsChan      chan *simplifiedUser
-	connectionsChan chan connectionsRequest
-	followQueue     chan *followRequest
-	followerQueue   chan *followRequest
-	//statuses of channels
-	profileStatus     string
-	followStatus      string
-	followingStatus   string
-	connectionsStatus string
-	tweetsStatus      string
-	//the limit of the number of followers to scrape.  If the number of followers is greater than this, the followers will not be scraped.
-	followLimit int
+	//wakes up the worker of a job kind when a job is enqueued
+	jobSignals map[string]chan struct{}
+	//how failed jobs of each kind are retried
+	retryPolicies map[string]retryPolicy
+	followQueue   chan *followRequest
+	followerQueue chan *followRequest
+	//progress of every worker, shown on the dashboard
+	status *statusRegistry
+	//pauses workers and cancels jobs from the dashboard
+	control *jobControl
+	//how far before the last complete collection of a timeline the tweets worker starts collecting
+	tweetOverlap time.Duration
+	//stores a profile snapshot on every scrape instead of only when the profile changed
+	snapshotAlways bool
+	//the global limits of the number of followers, followings and connections to scrape.  Lists that are longer are not scraped.
+	//participants and cohorts can override them
+	followLimits followLimits
+	//collects the first samplePages pages of lists over the follow limit instead of skipping them
+	sampleOverLimit bool
+	samplePages     int
+	//how far the network around participants is collected
+	expansion expansionPolicy
+	//deduplicates and caches profile scrapes across workers
+	profiles *profileLookup
+	//scores the sentiment and toxicity of collected tweets
+	scorer *scoring.Scorer
 }
 
+// shutdownTimeout is how long in flight web requests get to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	//Sets up Logs
 	//TODO: allow changing logs via command line flags
@@ -109,11 +139,23 @@ func main() {
 
 	//Loading Bearer Tokens and API keys
 	infoLog.Println("Loading Bearer Tokens...")
-	bearerToken := os.Getenv("BEARER_TOKEN")
-	bearerToken2 := os.Getenv("BEARER_TOKEN2")
+	tokens := newTokenPool(bearerTokensFromEnv(os.Getenv))
+	infoLog.Printf("%d bearer tokens loaded", tokens.size())
 	apiKey := os.Getenv("API_KEY")
 	secretKey := os.Getenv("SECRET_KEY")
 
+	//Loading retry policies of the workers
+	retryPolicies, err := retryPoliciesFromEnv(os.Getenv)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	//Loading follow limits, the flags below default to them
+	envLimits, err := followLimitsFromEnv(os.Getenv)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
 	//Connects to the database using .env variables
 	infoLog.Println("Connecting to database...")
 	dburl := "postgres://" + os.Getenv("DB_USER") + ":" + os.Getenv("DB_PASS") + "@" + os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT") + "/" + os.Getenv("DB_NAME")
@@ -127,6 +169,48 @@ func main() {
 	//Loads web address and sets up server structs for dependency injection
 	defaultAddr := os.Getenv("WEB_ADDR")
 	addr := flag.String("addr", defaultAddr, "HTTP network address")
+	fixtures := flag.String("fixtures", "", "Path to a json fixture file.  If set, twitter data is served from the fixtures instead of the live site")
+	tweetOverlap := flag.Duration("tweet-overlap", 48*time.Hour, "How far before the last complete collection of a timeline tweets are collected again, to update their likes, retweets and replies")
+	snapshots := flag.String("snapshots", "changed", "When a profile snapshot is stored after scraping a user: \"changed\" when the profile changed since the last snapshot, or \"always\"")
+	followerLimit := flag.Int("follower-limit", envLimits.followers, "Users with more followers than this do not have their followers scraped")
+	followingLimit := flag.Int("following-limit", envLimits.followings, "Users that follow more accounts than this do not have their followings scraped")
+	overLimit := flag.String("over-limit", "skip", "What happens to follower and following lists over the follow limit: \"skip\" them, or collect a \"sample\" of their first pages")
+	samplePages := flag.Int("sample-pages", 5, "How many pages of a list over the follow limit are collected with -over-limit sample")
+	connectionLimit := flag.Int("connection-limit", envLimits.connections, "Accounts around a participant with longer follower or following lists than this are not scraped for connections")
+	depth := flag.Int("depth", 1, "How far the network around participants is collected: 0 for their followers and followings, 1 for the follows between those accounts, 2 for friends of friends")
+	expand := flag.String("expand", "all", "Which accounts around participants are expanded: \"all\", or comma separated filters \"persons\" and \"participants=N\" for accounts that follow at least N participants")
+	profileTTL := flag.Duration("profile-ttl", 24*time.Hour, "How long a stored profile is used instead of scraping it again when workers look up accounts, 0 always scrapes")
+	sentimentLexicon := flag.String("sentiment-lexicon", "./data/sentiment_lexicon.tsv", "Path to the lexicon tweets are scored for sentiment with, a word and its valence from -4 to 4 on each line, separated by a tab")
+	toxicityWords := flag.String("toxicity-words", "./data/toxicity_words.txt", "Path to the word list tweets are scored for toxicity with, a word on each line, words ending in * match every word they start")
+	flag.Parse()
+
+	if *snapshots != "changed" && *snapshots != "always" {
+		errLog.Fatalf("invalid -snapshots %q, expected \"changed\" or \"always\"", *snapshots)
+	}
+	if *overLimit != "skip" && *overLimit != "sample" {
+		errLog.Fatalf("invalid -over-limit %q, expected \"skip\" or \"sample\"", *overLimit)
+	}
+	if *samplePages < 1 {
+		errLog.Fatalf("invalid -sample-pages %d, expected at least 1", *samplePages)
+	}
+	if *profileTTL < 0 {
+		errLog.Fatalf("invalid -profile-ttl %s, expected a duration that is not negative", *profileTTL)
+	}
+	if *depth < 0 || *depth > maxExpansionDepth {
+		errLog.Fatalf("invalid -depth %d, expected 0 to %d", *depth, maxExpansionDepth)
+	}
+	expansion := expansionPolicy{depth: *depth}
+	err = parseExpansionFilter(&expansion, *expand)
+	if err != nil {
+		errLog.Fatalf("invalid -expand: %s", err)
+	}
+
+	//Loads the word lists tweets are scored with
+	infoLog.Println("Loading scoring word lists...")
+	scorer, err := scoring.Load(*sentimentLexicon, *toxicityWords)
+	if err != nil {
+		errLog.Fatal(err)
+	}
 
 	//Initializes template cache
 	infoLog.Println("Initializing template cache...")
@@ -145,73 +229,51 @@ func main() {
 	sessionManager.Store = pgxstore.New(conn)
 	sessionManager.Lifetime = 12 * time.Hour
 
-	//Initializes http clients
-	infoLog.Println("Initializing http clients...")
-	followerClient := http.Client{}
+	//Initializes the twitter source, either the live scraper and v2 client or the fixtures
+	var source TwitterSource
+	if *fixtures != "" {
+		infoLog.Printf("Loading fixtures from %s...", *fixtures)
+		source, err = loadFixtureSource(*fixtures)
+		if err != nil {
+			errLog.Fatal(err)
+		}
+	} else {
+		infoLog.Println("Initializing twitter clients...")
+		source = newLiveSource(tokens, infoLog, errLog)
+	}
 
 	//Initializing channels
 	infoLog.Println("Initializing channels...")
-	profileChan := make(chan *simplifiedUser, 100)
-	followChan := make(chan *models.SimpleRequest, 3000)
-	followerChan := make(chan *models.SimpleRequest, 3000)
-	tweetsChan := make(chan *simplifiedUser, 100)
-	connectionsChan := make(chan connectionsRequest, 100)
 	followQueue := make(chan *followRequest, 1000)
 	followerQueue := make(chan *followRequest, 1000)
 
-	defer close(profileChan)
-	defer close(followChan)
-	defer close(followerChan)
-	defer close(tweetsChan)
-	defer close(connectionsChan)
-	defer close(followQueue)
-	defer close(followerQueue)
-
-	profileStatus := "idle"
-	followStatus := "idle"
-	followingStatus := "idle"
-	tweetsStatus := "idle"
-	connectionsStatus := "idle"
-
 	app := &application{
-		errorLog:          errLog,
-		infoLog:           infoLog,
-		connection:        conn,
-		scraper:           *twitterscraper.New(),
-		debug:             false,
-		templateCache:     templateCache,
-		formDecoder:       formDecoder,
-		sessionManager:    sessionManager,
-		bearerToken:       bearerToken,
-		bearerToken2:      bearerToken2,
-		apiKey:            apiKey,
-		secretKey:         secretKey,
-		followerClient:    followerClient,
-		profileChan:       profileChan,
-		followChan:        followChan,
-		followerChan:      followerChan,
-		tweetsChan:        tweetsChan,
-		connectionsChan:   connectionsChan,
-		followQueue:       followQueue,
-		followerQueue:     followerQueue,
-		profileStatus:     profileStatus,
-		followStatus:      followStatus,
-		followingStatus:   followingStatus,
-		tweetsStatus:      tweetsStatus,
-		connectionsStatus: connectionsStatus,
-		followLimit:       1000,
+		errorLog:        errLog,
+		infoLog:         infoLog,
+		connection:      conn,
+		source:          source,
+		debug:           false,
+		templateCache:   templateCache,
+		formDecoder:     formDecoder,
+		sessionManager:  sessionManager,
+		apiKey:          apiKey,
+		secretKey:       secretKey,
+		jobSignals:      newJobSignals(),
+		retryPolicies:   retryPolicies,
+		followQueue:     followQueue,
+		followerQueue:   followerQueue,
+		status:          newStatusRegistry(),
+		control:         newJobControl(),
+		tweetOverlap:    *tweetOverlap,
+		snapshotAlways:  *snapshots == "always",
+		followLimits:    followLimits{*followerLimit, *followingLimit, *connectionLimit},
+		sampleOverLimit: *overLimit == "sample",
+		samplePages:     *samplePages,
+		expansion:       expansion,
+		profiles:        newProfileLookup(*profileTTL),
+		scorer:          scorer,
 	}
 
-	//Initializes concurrent workers
-	infoLog.Println("Initializing concurrent workers...")
-	go app.ProfileWorker()
-	go app.FollowWorker()
-	go app.FollowerWorker()
-	go app.TweetsWorker()
-	go app.ConnectionsWorker()
-	go app.FollowerQueue()
-	go app.FollowingQueue()
-
 	srv := &http.Server{
 		Addr:     *addr,
 		ErrorLog: errLog,
@@ -224,6 +286,12 @@ func main() {
 	fmt.Printf("~~To select a command, ender it's number below.~~\n")
 	fmt.Printf("~~You can use the following commands to interact with the program:~~\n")
 
+	//Brings the schema up to date before any option touches the database, a new database has no tables to migrate until option 1 creates them
+	err = models.Migrate(app.connection)
+	if err != nil {
+		errLog.Println("Error migrating database, initialize the tables if this is a new database:", err)
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 	choosing := true
 	for choosing {
@@ -232,7 +300,9 @@ func main() {
 		fmt.Printf("\n 3) Scrape User and add to Database")
 		fmt.Printf("\n 4) List all users in Database")
 		fmt.Printf("\n 5) Add Admin User")
-		fmt.Printf("\n 6) Quit")
+		fmt.Printf("\n 6) Resolve Duplicate Handles")
+		fmt.Printf("\n 7) Score Tweets")
+		fmt.Printf("\n 8) Quit")
 		fmt.Printf("\n")
 
 		char, _, err := reader.ReadRune()
@@ -267,6 +337,10 @@ func main() {
 		case '5':
 			app.addAdmin(reader)
 		case '6':
+			app.resolveDuplicateHandles()
+		case '7':
+			app.scoreTweetsCLI(reader)
+		case '8':
 			fmt.Printf("\n~~Quitting~~\n")
 			os.Exit(0)
 		}
@@ -274,19 +348,77 @@ func main() {
 
 	}
 
-	app.infoLog.Println("Loading Backups...")
-	app.loadBackups()
-	app.infoLog.Printf("Starting server on %s...", *addr)
-	err = srv.ListenAndServe()
-	errLog.Fatal(err)
+	//Brings the schema up to date before any worker touches the database
+	app.infoLog.Println("Migrating database...")
+	err = models.Migrate(app.connection)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	//Puts jobs interrupted by the last shutdown back in the queue
+	app.infoLog.Println("Resuming jobs...")
+	err = app.resumeJobs()
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	//Cancels ctx on SIGINT or SIGTERM so the server and workers can stop cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	//Initializes concurrent workers
+	infoLog.Println("Initializing concurrent workers...")
+	var workers sync.WaitGroup
+	for _, worker := range []func(context.Context){
+		app.ProfileWorker,
+		app.FollowWorker,
+		app.FollowerWorker,
+		app.TweetsWorker,
+		app.ConnectionsWorker,
+		app.FollowerQueue,
+		app.FollowingQueue,
+		app.Scheduler,
+	} {
+		workers.Add(1)
+		go func(worker func(context.Context)) {
+			defer workers.Done()
+			worker(ctx)
+		}(worker)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		app.infoLog.Printf("Starting server on %s...", *addr)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		errLog.Println(err)
+		stop()
+	case <-ctx.Done():
+		infoLog.Println("Shutting down...")
+	}
 
+	//Stops accepting requests and lets in flight requests finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		errLog.Println("Error shutting down server:", err)
+	}
+
+	//Waits for the workers to checkpoint and requeue their jobs
+	workers.Wait()
+	app.logShutdownSummary()
+	infoLog.Println("Stopped")
 }
 
 func (app *application) scrapeCLI(r *bufio.Reader) {
 	fmt.Printf("\n~~Please enter a twitter username to scrape~~\n")
 	username, _ := r.ReadString('\n')
 	username = username[:len(username)-1]
-	user, err := app.scrapeUser(username)
+	user, err := app.scrapeUser(context.Background(), username)
 	if err != nil {
 		app.errorLog.Println(err)
 		return
@@ -297,6 +429,50 @@ func (app *application) scrapeCLI(r *bufio.Reader) {
 	}
 }
 
+// resolveDuplicateHandles looks up the current handle of every user row that shares its handle with another row.
+// The ID of a user is its Twitter account ID, so the rows are different accounts, and those that were renamed since they were collected
+// get their current handle, with the stale one kept in their handle history.  Accounts that no longer exist have their state recorded.
+func (app *application) resolveDuplicateHandles() {
+	fmt.Printf("\n~~Resolving duplicate handles~~\n")
+	duplicates, err := models.GetDuplicateUsers(app.connection)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+
+	resolved := 0
+	for _, duplicate := range duplicates {
+		for _, ID := range duplicate.UserIDs {
+			current, err := app.source.LookupUser(context.Background(), ID)
+			if err != nil {
+				if state, ok := accountStateOf(err); ok {
+					app.updateAccountState(ID, duplicate.Handle, state)
+					continue
+				}
+				app.errorLog.Printf("Error looking up user %d: %s", ID, err)
+				continue
+			}
+			if strings.EqualFold(current, duplicate.Handle) {
+				continue
+			}
+
+			err = models.UpdateUserHandle(app.connection, &models.User{ID: ID, Handle: current})
+			if err != nil {
+				app.errorLog.Printf("Error updating handle of user %d: %s", ID, err)
+				continue
+			}
+			//the lookup does not say if the account is protected, so a state that stops collection is kept
+			state, err := models.GetAccountState(app.connection, ID)
+			if err == nil && models.AccountCollectable(state) {
+				app.updateAccountState(ID, current, models.AccountRenamed)
+			}
+			fmt.Printf("User %d renamed from %s to %s\n", ID, duplicate.Handle, current)
+			resolved++
+		}
+	}
+	fmt.Printf("\n~~Updated %d stale handles~~\n", resolved)
+}
+
 func (app *application) addAdmin(r *bufio.Reader) {
 	fmt.Printf("\n~~Please enter an email to add as an admin~~\n")
 	username, _ := r.ReadString('\n')
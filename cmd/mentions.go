@@ -0,0 +1,75 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	twitterscraper "github.com/n0madic/twitter-scraper"
+)
+
+var (
+	//the links the scraper puts around the mentions it finds in the HTML of a tweet
+	mentionLink = regexp.MustCompile(`<a href="https://twitter\.com/([^"/?#]+)">[@＠]`)
+	//a mention in text is an @ that does not follow a letter, number, underscore or another @, then a handle of up to 15 characters.
+	//the last group catches handles that go on past what a handle can be, those are not mentions
+	mentionText = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_@＠])[@＠]([A-Za-z0-9_]{1,15})([\p{L}\p{M}\p{N}_@＠]?)`)
+	//the characters a handle can have, the scraper links some trailing punctuation along with the handle
+	handlePrefix = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}`)
+	//the text of a retweet starts with the handle of the retweeted user
+	retweetPrefix = regexp.MustCompile(`^RT [@＠][A-Za-z0-9_]{1,15}:`)
+)
+
+// getMentions returns the lower case handles of the users mentioned in a tweet, each once, in the order they are first mentioned.
+// The mentions the scraper linked in the HTML of the tweet are used, and the text of the tweet is searched when there is no HTML.
+// The handle of the retweeted user at the start of a retweet is not a mention.
+func getMentions(tweet *twitterscraper.Tweet) []string {
+	var handles []string
+	if tweet.HTML != "" {
+		handles = linkedMentions(tweet.HTML)
+	} else {
+		handles = textMentions(tweet.Text)
+	}
+	if retweetPrefix.MatchString(tweet.Text) && len(handles) > 0 {
+		handles = handles[1:]
+	}
+
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, handle := range handles {
+		handle = strings.ToLower(handle)
+		if !seen[handle] {
+			seen[handle] = true
+			mentions = append(mentions, handle)
+		}
+	}
+	return mentions
+}
+
+// linkedMentions returns the handles the scraper linked in the HTML of a tweet.
+func linkedMentions(html string) []string {
+	var handles []string
+	for _, match := range mentionLink.FindAllStringSubmatch(html, -1) {
+		handle := handlePrefix.FindString(match[1])
+		if handle != "" {
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+// textMentions returns the handles mentioned in the text of a tweet.  Email addresses, handles that are too long
+// or run into other letters, and handles followed by "://" are not mentions.
+func textMentions(text string) []string {
+	var handles []string
+	for _, match := range mentionText.FindAllStringSubmatchIndex(text, -1) {
+		//the handle is cut short by a character a handle cannot have
+		if match[5] > match[4] {
+			continue
+		}
+		if strings.HasPrefix(text[match[3]:], "://") {
+			continue
+		}
+		handles = append(handles, text[match[2]:match[3]])
+	}
+	return handles
+}
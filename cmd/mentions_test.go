@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	twitterscraper "github.com/n0madic/twitter-scraper"
+)
+
+func TestTextMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "single", text: "hello @alice", want: []string{"alice"}},
+		{name: "start of text", text: "@alice hi", want: []string{"alice"}},
+		{name: "several", text: "@alice and @Bob_2, thanks!", want: []string{"alice", "Bob_2"}},
+		{name: "trailing punctuation", text: "thanks @alice.", want: []string{"alice"}},
+		{name: "full width at", text: "hi ＠alice", want: []string{"alice"}},
+		{name: "after comma", text: "@alice,@bob", want: []string{"alice", "bob"}},
+		{name: "email address", text: "mail me at alice@example.com", want: nil},
+		{name: "too long", text: "@abcdefghijklmnop", want: nil},
+		{name: "runs into letters", text: "@alicé", want: nil},
+		{name: "double at", text: "@@alice", want: nil},
+		{name: "link scheme", text: "@http://example.com", want: nil},
+		{name: "no mentions", text: "just text", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := textMentions(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("textMentions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkedMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []string
+	}{
+		{name: "single", html: `hi <a href="https://twitter.com/alice">@alice</a>`, want: []string{"alice"}},
+		{name: "several", html: `<a href="https://twitter.com/alice">@alice</a> <a href="https://twitter.com/Bob">＠Bob</a>`, want: []string{"alice", "Bob"}},
+		{name: "trailing punctuation", html: `<a href="https://twitter.com/alice.">@alice.</a>`, want: []string{"alice"}},
+		{name: "hashtag link", html: `<a href="https://twitter.com/hashtag/go">#go</a>`, want: nil},
+		{name: "other link", html: `<a href="https://twitter.com/alice">alice</a>`, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := linkedMentions(tt.html)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("linkedMentions(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMentions(t *testing.T) {
+	tests := []struct {
+		name  string
+		tweet twitterscraper.Tweet
+		want  []string
+	}{
+		{name: "text", tweet: twitterscraper.Tweet{Text: "@Alice and @alice and @bob"}, want: []string{"alice", "bob"}},
+		{name: "html first", tweet: twitterscraper.Tweet{Text: "@alice @bob", HTML: `<a href="https://twitter.com/carol">@carol</a>`}, want: []string{"carol"}},
+		{name: "retweet", tweet: twitterscraper.Tweet{Text: "RT @alice: hi @bob"}, want: []string{"bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getMentions(&tt.tweet)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getMentions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// profileLookup deduplicates profile scrapes across workers.  Profiles stored less than ttl ago are read from the users table,
+// and workers that need a profile that is being scraped at that moment wait for that scrape instead of starting their own.
+type profileLookup struct {
+	ttl time.Duration
+
+	mu sync.Mutex
+	//the scrapes in progress, keyed by lower case handle
+	inflight map[string]*profileCall
+	hits     int
+	misses   int
+	shared   int
+}
+
+// profileCall is a single profile scrape that any number of workers can wait for.  user and err are set before done is closed.
+type profileCall struct {
+	done chan struct{}
+	user *models.User
+	err  error
+}
+
+// profileStats are the counters of the profile lookup shown on the dashboard.
+// Hits were read from the database, Misses were scraped, and Shared waited for a scrape another worker had already started.
+type profileStats struct {
+	Hits   int
+	Misses int
+	Shared int
+	TTL    time.Duration
+}
+
+// newProfileLookup creates a profile lookup that reads stored profiles younger than ttl.  A ttl of 0 always scrapes.
+func newProfileLookup(ttl time.Duration) *profileLookup {
+	return &profileLookup{
+		ttl:      ttl,
+		inflight: make(map[string]*profileCall),
+	}
+}
+
+// stats returns a copy of the counters.
+func (l *profileLookup) stats() profileStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return profileStats{Hits: l.hits, Misses: l.misses, Shared: l.shared, TTL: l.ttl}
+}
+
+// count adds one to a counter.
+func (l *profileLookup) count(counter *int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*counter++
+}
+
+// lookupUser returns the profile of a handle.  A profile stored within the ttl is returned from the database,
+// any other profile is scraped with scrapeUser.
+func (app *application) lookupUser(ctx context.Context, handle string) (*models.User, error) {
+	lookup := app.profiles
+	if lookup.ttl > 0 {
+		user, err := models.GetUserByHandle(app.connection, handle)
+		if err == nil && user.CollectedAt != nil && time.Since(*user.CollectedAt) < lookup.ttl {
+			lookup.count(&lookup.hits)
+			return user, nil
+		}
+	}
+	return app.scrapeUser(ctx, handle)
+}
+
+// scrapeUser scrapes the profile of a handle.  If the handle is already being scraped, the result of that scrape is returned instead.
+// A waiting worker whose own context is still live scrapes again when the scrape it waited for was cancelled.
+func (app *application) scrapeUser(ctx context.Context, handle string) (*models.User, error) {
+	lookup := app.profiles
+	key := strings.ToLower(handle)
+	for {
+		lookup.mu.Lock()
+		call, ok := lookup.inflight[key]
+		if !ok {
+			call = &profileCall{done: make(chan struct{})}
+			lookup.inflight[key] = call
+			lookup.misses++
+		} else {
+			lookup.shared++
+		}
+		lookup.mu.Unlock()
+
+		if !ok {
+			call.user, call.err = app.fetchUser(ctx, handle)
+			lookup.mu.Lock()
+			delete(lookup.inflight, key)
+			lookup.mu.Unlock()
+			close(call.done)
+			return call.user, call.err
+		}
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded) {
+			continue
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		//every worker gets its own copy, since callers change the user before storing it
+		user := *call.user
+		return &user, nil
+	}
+}
@@ -1,8 +1,10 @@
-// TODO: getFollows and getFollowers can be unified into a single function
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -30,8 +32,15 @@ type meta struct {
 
 // followerResponse is the struct of the expected response from the twitter api
 type followerResponse struct {
-	Data []singleFollow `json:"data"`
-	Meta meta           `json:"meta"`
+	Data   []singleFollow `json:"data"`
+	Meta   meta           `json:"meta"`
+	Errors []apiError     `json:"errors"`
+}
+
+// userResponse is the struct of the expected response from the twitter api user lookup
+type userResponse struct {
+	Data   singleFollow `json:"data"`
+	Errors []apiError   `json:"errors"`
 }
 
 // getURL returns the twitter v2 api url for a given endpoint
@@ -44,185 +53,180 @@ func getFollowURL(uid int64, followStatus string, pageToken string) string {
 }
 
 // getResponse returns the response from a given url.  This is used in tandem with getURL to get the response from the twitter api
-// This also adds important headers to the request
-func (app *application) getResponse(url string, bearer string) (*http.Response, error) {
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+// This also adds important headers to the request.  The request is made with a bearer token from the pool that has budget left on the endpoint,
+// and is retried on another token (or after the limit resets) if twitter responds with 429.
+func (src *liveSource) getResponse(ctx context.Context, url string, endpoint string) (*http.Response, error) {
+	if src.tokens.size() == 0 {
+		return nil, errors.New("no bearer tokens configured")
 	}
-	request.Header.Set("Authorization", "Bearer "+bearer)
-	request.Header.Set("Content-Type", "application/json")
 
-	resp, err := app.followerClient.Do(request)
-	if err != nil {
-		app.errorLog.Println("Error getting response from url:", url)
-		return nil, err
-	}
-
-	return resp, nil
+	for {
+		token, err := src.tokens.acquire(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
 
-}
+		request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+token.value)
+		request.Header.Set("Content-Type", "application/json")
 
-// getFollowers scrapes a user's profile and returns a slice of models.Follow structs of users that follow a user
-func (app *application) getFollowers(user *models.SimpleRequest) ([]*models.Follow, error) {
-	var followers []*models.Follow
-	var pageToken string
-	currTime := time.Now()
-	//get the first page of followers, then continues going as long as there is a next page
-	for {
-		url := getFollowURL(user.UID, "followers", pageToken)
-		resp, err := app.getResponse(url, app.bearerToken)
+		resp, err := src.client.Do(request)
 		if err != nil {
-			app.errorLog.Println(err)
+			src.errorLog.Println("Error getting response from url:", url)
 			return nil, err
 		}
-		defer resp.Body.Close()
-
-		//checks if the response is ok
-		if resp.StatusCode == http.StatusOK {
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				app.errorLog.Println(err)
-				return nil, err
-			}
-
-			//unmarshal the response into a followerResponse struct
-			var followerResponse followerResponse
-			err = json.Unmarshal(body, &followerResponse)
-			if err != nil {
-				app.errorLog.Println(err)
-				return nil, err
-			}
-
-			if app.debug {
-				app.infoLog.Printf("%v\n", followerResponse)
-			}
-
-			//iterate through the followers and add them to the slice
-			for _, follower := range followerResponse.Data {
-
-				followerID, err := strconv.ParseInt(follower.ID, 10, 64)
-				if err != nil {
-					app.errorLog.Println("error converting follower id to int:", err)
-					return nil, err
-				}
-
-				//trims the extra characters from the twitter response
-				toTrim := strings.Index(follower.CreatedAt, "T")
-				if toTrim == -1 {
-					continue
-				}
-				follower.CreatedAt = follower.CreatedAt[:toTrim]
-				createdAt, err := time.Parse(models.Format, follower.CreatedAt)
-				if err != nil {
-					app.errorLog.Println("error parsing time:", err)
-					return nil, err
-				}
-
-				followers = append(followers, &models.Follow{
-					FollowerID:       followerID,
-					FollowerUsername: follower.Username,
-					CreatedAt:        createdAt,
-					FolloweeID:       user.UID,
-					FolloweeUsername: user.Username,
-					CollectedAt:      currTime,
-				})
-			}
-			//if there is a next page, set the page token to the next page
-			//otherwise, break out of the loop
-			pageToken = followerResponse.Meta.NextToken
-			if pageToken == "" {
-				break
-			}
-			//sleep 60 seconds to avoid rate limiting
-			time.Sleep(60 * time.Second)
-		} else {
-			app.errorLog.Printf("error getting followers for user %d.  Status code: %d\n", user.UID, resp.StatusCode)
-			return nil, fmt.Errorf("error getting followers for user %d.  Status code: %d", user.UID, resp.StatusCode)
+
+		src.tokens.update(token, endpoint, resp)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return src.checkRefused(token, resp)
 		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		resp.Body.Close()
+		src.infoLog.Printf("Rate limited on %s, rescheduling request", endpoint)
+	}
+}
 
+// checkRefused checks a 401 or 403 response made with token.  A response that explains itself with the state of the account is returned as it is,
+// with its body still readable.  A bare 401 or 403 means twitter refused the token, so the token is parked and a retryable error is returned.
+func (src *liveSource) checkRefused(token *bearerToken, resp *http.Response) (*http.Response, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if classifyAPIError(body) != nil {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return resp, nil
 	}
-	return followers, nil
+
+	src.tokens.park(token, time.Now().Add(tokenParkWindow))
+	src.errorLog.Printf("Bearer token refused with status code %d, parked for %s", resp.StatusCode, tokenParkWindow)
+	return nil, fmt.Errorf("bearer token refused with status code %d", resp.StatusCode)
+}
+
+// FollowersPage returns one page of follows of users that follow a user, and the token of the next page
+func (src *liveSource) FollowersPage(ctx context.Context, user *models.SimpleRequest, pageToken string) ([]*models.Follow, string, error) {
+	return src.getFollowPage(ctx, user, "followers", pageToken)
+}
+
+// FollowingsPage returns one page of follows of users that a user follows, and the token of the next page
+func (src *liveSource) FollowingsPage(ctx context.Context, user *models.SimpleRequest, pageToken string) ([]*models.Follow, string, error) {
+	return src.getFollowPage(ctx, user, "following", pageToken)
 }
 
-// getFollows scrapes a user's profile and returns a slice of models.Follow structs of users that a user follows
-func (app *application) getFollows(user *models.SimpleRequest) ([]*models.Follow, error) {
+// getFollowPage requests a single page of followers or followings of a user from the v2 api.  followStatus is "followers" or "following".
+// Returns the page as a slice of models.Follow structs and the token of the next page, which is empty on the last page.
+func (src *liveSource) getFollowPage(ctx context.Context, user *models.SimpleRequest, followStatus string, pageToken string) ([]*models.Follow, string, error) {
 	var follows []*models.Follow
-	var pageToken string
 	currTime := time.Now()
-	//get the first page of followers, then continues going as long as there is a next page
-	for {
-		url := getFollowURL(user.UID, "following", pageToken)
-		resp, err := app.getResponse(url, app.bearerToken2)
+
+	url := getFollowURL(user.UID, followStatus, pageToken)
+	resp, err := src.getResponse(ctx, url, followStatus)
+	if err != nil {
+		src.errorLog.Println(err)
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		src.errorLog.Println(err)
+		return nil, "", err
+	}
+
+	//checks if the response is ok.  Protected, suspended and deleted accounts are reported as account errors
+	if resp.StatusCode != http.StatusOK {
+		src.errorLog.Printf("error getting %s for user %d.  Status code: %d\n", followStatus, user.UID, resp.StatusCode)
+		if accountErr := classifyAPIError(body); accountErr != nil {
+			return nil, "", accountErr
+		}
+		return nil, "", fmt.Errorf("error getting %s for user %d.  Status code: %d", followStatus, user.UID, resp.StatusCode)
+	}
+
+	//unmarshal the response into a followerResponse struct
+	var followerResponse followerResponse
+	err = json.Unmarshal(body, &followerResponse)
+	if err != nil {
+		src.errorLog.Println(err)
+		return nil, "", err
+	}
+
+	if src.debug {
+		src.infoLog.Printf("%v\n", followerResponse)
+	}
+
+	//twitter answers some requests about unavailable accounts with 200 and only errors
+	if len(followerResponse.Data) == 0 && len(followerResponse.Errors) > 0 {
+		if accountErr := classifyAPIError(body); accountErr != nil {
+			return nil, "", accountErr
+		}
+	}
+
+	//iterate through the users of the page and add them to the slice
+	for _, other := range followerResponse.Data {
+
+		otherID, err := strconv.ParseInt(other.ID, 10, 64)
 		if err != nil {
-			app.errorLog.Println(err)
-			return nil, err
+			src.errorLog.Println("error converting follower id to int:", err)
+			return nil, "", err
+		}
+
+		//trims the extra characters from the twitter response
+		toTrim := strings.Index(other.CreatedAt, "T")
+		if toTrim == -1 {
+			continue
+		}
+		other.CreatedAt = other.CreatedAt[:toTrim]
+		createdAt, err := time.Parse(models.Format, other.CreatedAt)
+		if err != nil {
+			src.errorLog.Println("error parsing time:", err)
+			return nil, "", err
 		}
-		defer resp.Body.Close()
-
-		//checks if the response is ok
-		if resp.StatusCode == http.StatusOK {
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				app.errorLog.Println(err)
-				return nil, err
-			}
-
-			//unmarshal the response into a followerResponse struct
-			var followerResponse followerResponse
-			err = json.Unmarshal(body, &followerResponse)
-			if err != nil {
-				app.errorLog.Println(err)
-				return nil, err
-			}
-
-			if app.debug {
-				app.infoLog.Printf("%v\n", followerResponse)
-			}
-
-			//iterate through the followers and add them to the slice
-			for _, follower := range followerResponse.Data {
-
-				followerID, err := strconv.ParseInt(follower.ID, 10, 64)
-				if err != nil {
-					app.errorLog.Println("error converting follower id to int:", err)
-					return nil, err
-				}
-
-				//trims the extra characters from the twitter response
-				toTrim := strings.Index(follower.CreatedAt, "T")
-				if toTrim == -1 {
-					continue
-				}
-				follower.CreatedAt = follower.CreatedAt[:toTrim]
-				createdAt, err := time.Parse(models.Format, follower.CreatedAt)
-				if err != nil {
-					app.errorLog.Println("error parsing time:", err)
-					return nil, err
-				}
-
-				follows = append(follows, &models.Follow{
-					FollowerID:       user.UID,
-					FollowerUsername: user.Username,
-					CreatedAt:        createdAt,
-					FolloweeID:       followerID,
-					FolloweeUsername: follower.Username,
-					CollectedAt:      currTime,
-				})
-			}
-			//if there is a next page, set the page token to the next page
-			//otherwise, break out of the loop
-			pageToken = followerResponse.Meta.NextToken
-			if pageToken == "" {
-				break
-			}
-			//sleep 60 seconds to avoid rate limiting
-			time.Sleep(60 * time.Second)
+
+		//the user is the followee of their followers, and the follower of their followings
+		follow := &models.Follow{
+			CreatedAt:   createdAt,
+			CollectedAt: currTime,
+		}
+		if followStatus == "followers" {
+			follow.FollowerID, follow.FollowerUsername = otherID, other.Username
+			follow.FolloweeID, follow.FolloweeUsername = user.UID, user.Username
 		} else {
-			app.errorLog.Printf("error getting followers for user %d.  Status code: %d\n", user.UID, resp.StatusCode)
-			return nil, fmt.Errorf("error getting followers for user %d.  Status code: %d", user.UID, resp.StatusCode)
+			follow.FollowerID, follow.FollowerUsername = user.UID, user.Username
+			follow.FolloweeID, follow.FolloweeUsername = otherID, other.Username
 		}
+		follows = append(follows, follow)
+	}
 
+	return follows, followerResponse.Meta.NextToken, nil
+}
+
+// LookupUser returns the current handle of a user from the v2 api.  This finds accounts that were renamed, since their id does not change.
+func (src *liveSource) LookupUser(ctx context.Context, uid int64) (string, error) {
+	url := fmt.Sprintf("https://api.twitter.com/2/users/%d", uid)
+	resp, err := src.getResponse(ctx, url, "users")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var user userResponse
+	err = json.Unmarshal(body, &user)
+	if resp.StatusCode != http.StatusOK || err != nil || user.Data.Username == "" {
+		if accountErr := classifyAPIError(body); accountErr != nil {
+			return "", accountErr
+		}
+		return "", fmt.Errorf("error looking up user %d.  Status code: %d", uid, resp.StatusCode)
 	}
-	return follows, nil
+	return user.Data.Username, nil
 }
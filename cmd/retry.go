@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// retryPolicy decides how often and how soon a failed job of a kind is retried.
+// The delay before attempt n+1 is backoff * 2^(n-1), capped at maxBackoff, then spread by up to jitter (a fraction of the delay) either way.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	jitter      float64
+}
+
+// defaultRetryPolicy is used for every job kind that is not configured.
+var defaultRetryPolicy = retryPolicy{
+	maxAttempts: 5,
+	backoff:     30 * time.Second,
+	maxBackoff:  time.Hour,
+	jitter:      0.2,
+}
+
+// delay returns how long to wait before retrying a job that has failed attempts times.
+func (p retryPolicy) delay(attempts int) time.Duration {
+	delay := p.backoff
+	for i := 1; i < attempts && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.maxBackoff {
+		delay = p.maxBackoff
+	}
+	if p.jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.jitter * float64(delay))
+	}
+	return delay
+}
+
+// retryPoliciesFromEnv builds the retry policy of every job kind.  The policy of a kind is read from RETRY_<KIND>, e.g. RETRY_PROFILE,
+// as comma separated settings: "attempts=5,backoff=30s,max_backoff=1h,jitter=0.2".  Settings that are left out keep their default.
+func retryPoliciesFromEnv(getenv func(string) string) (map[string]retryPolicy, error) {
+	policies := make(map[string]retryPolicy)
+	for _, kind := range jobKinds {
+		name := "RETRY_" + strings.ToUpper(kind)
+		policy, err := parseRetryPolicy(getenv(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		policies[kind] = policy
+	}
+	return policies, nil
+}
+
+// parseRetryPolicy parses the settings of a single retry policy on top of defaultRetryPolicy.
+func parseRetryPolicy(settings string) (retryPolicy, error) {
+	policy := defaultRetryPolicy
+	for _, setting := range strings.Split(settings, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return policy, fmt.Errorf("expected key=value, got %q", setting)
+		}
+
+		var err error
+		switch strings.TrimSpace(key) {
+		case "attempts":
+			policy.maxAttempts, err = strconv.Atoi(value)
+			if err == nil && policy.maxAttempts < 1 {
+				err = fmt.Errorf("attempts must be at least 1")
+			}
+		case "backoff":
+			policy.backoff, err = time.ParseDuration(value)
+		case "max_backoff":
+			policy.maxBackoff, err = time.ParseDuration(value)
+		case "jitter":
+			policy.jitter, err = strconv.ParseFloat(value, 64)
+			if err == nil && (policy.jitter < 0 || policy.jitter > 1) {
+				err = fmt.Errorf("jitter must be between 0 and 1")
+			}
+		default:
+			err = fmt.Errorf("unknown setting %q", key)
+		}
+		if err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// retryOrFail records the error of a failed attempt of a job, then either queues the job again after its backoff,
+// or moves it to the dead-letter list once it has used up the attempts of its retry policy.
+// Jobs that failed because of the state of an account, e.g. a suspended account, go to the dead-letter list straight away.
+func (app *application) retryOrFail(job *models.Job, jobErr error) error {
+	err := models.InsertJobError(app.connection, &models.JobError{
+		JobID:   job.ID,
+		Attempt: job.Attempts,
+		Error:   jobErr.Error(),
+	})
+	if err != nil {
+		return err
+	}
+
+	policy, ok := app.retryPolicies[job.Kind]
+	if !ok {
+		policy = defaultRetryPolicy
+	}
+	if state, ok := accountStateOf(jobErr); ok {
+		app.errorLog.Printf("%s job %d failed, account is %s: %s", job.Kind, job.ID, state, jobErr)
+		return models.FailJob(app.connection, job.ID, jobErr.Error())
+	}
+	if job.Attempts >= policy.maxAttempts {
+		app.errorLog.Printf("%s job %d failed permanently after %d attempts: %s", job.Kind, job.ID, job.Attempts, jobErr)
+		return models.FailJob(app.connection, job.ID, jobErr.Error())
+	}
+
+	delay := policy.delay(job.Attempts)
+	app.errorLog.Printf("%s job %d failed on attempt %d/%d, retrying in %s: %s", job.Kind, job.ID, job.Attempts, policy.maxAttempts, delay.Round(time.Second), jobErr)
+	return models.RetryJob(app.connection, job.ID, jobErr.Error(), time.Now().Add(delay))
+}
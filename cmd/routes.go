@@ -31,11 +31,24 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/users", protected.ThenFunc(app.users))
 	router.Handler(http.MethodGet, "/users/view/:id", protected.ThenFunc(app.userView))
 	router.Handler(http.MethodPost, "/users/view/:id", protected.ThenFunc(app.userViewPost))
+	router.Handler(http.MethodGet, "/users/view/:id/follow-changes", protected.ThenFunc(app.userFollowChanges))
+	router.Handler(http.MethodGet, "/users/view/:id/tweet-network", protected.ThenFunc(app.userTweetNetwork))
+	router.Handler(http.MethodGet, "/tweets/thread/:id", protected.ThenFunc(app.tweetThread))
+	router.Handler(http.MethodGet, "/domains", protected.ThenFunc(app.sharedDomains))
+	router.Handler(http.MethodGet, "/scores", protected.ThenFunc(app.tweetScores))
 	router.Handler(http.MethodGet, "/users/add", protected.ThenFunc(app.userAddGet))
 	router.Handler(http.MethodPost, "/users/add", protected.ThenFunc(app.userAddPost))
 	router.Handler(http.MethodGet, "/user/signup", protected.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", protected.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodPost, "/workers/:kind/pause", protected.ThenFunc(app.workerPausePost))
+	router.Handler(http.MethodPost, "/workers/:kind/resume", protected.ThenFunc(app.workerResumePost))
+	router.Handler(http.MethodPost, "/workers/:kind/drain", protected.ThenFunc(app.workerDrainPost))
+	router.Handler(http.MethodPost, "/jobs/:id/cancel", protected.ThenFunc(app.jobCancelPost))
+	router.Handler(http.MethodPost, "/schedules", protected.ThenFunc(app.schedulePost))
+	router.Handler(http.MethodPost, "/schedules/:id/delete", protected.ThenFunc(app.scheduleDeletePost))
+	router.Handler(http.MethodGet, "/jobs/failed", protected.ThenFunc(app.failedJobs))
+	router.Handler(http.MethodPost, "/jobs/failed/:id/requeue", protected.ThenFunc(app.failedJobRequeuePost))
 
 	//creates a middleware chain
 	standard := alice.New(app.recoverPanic, app.logRequest, securityHeaders)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// schedulerInterval is how often the scheduler checks for schedules that are due.
+const schedulerInterval = time.Minute
+
+// scheduleKinds are the kinds of jobs a schedule can queue.  Connections jobs are queued by followers and followings jobs when they finish.
+var scheduleKinds = []string{models.JobProfile, models.JobTweets, models.JobFollowers, models.JobFollowings}
+
+// Scheduler re-queues participants for every schedule that is due, until ctx is cancelled.
+func (app *application) Scheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		schedules, err := models.GetDueSchedules(app.connection)
+		if err != nil {
+			app.errorLog.Println("Error getting due schedules:", err)
+		}
+		for _, schedule := range schedules {
+			err = app.runSchedule(&schedule)
+			if err != nil {
+				app.errorLog.Printf("Error running schedule %d: %s", schedule.ID, err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			app.infoLog.Println("Scheduler finished")
+			return
+		}
+	}
+}
+
+// runSchedule queues a job of the schedule's kind for every participant it matches.
+// Participants that still have a job of that kind queued or running from a previous run are skipped.
+func (app *application) runSchedule(schedule *models.Schedule) error {
+	participants, err := models.GetParticipants(app.connection, schedule.SchoolID, schedule.Cohort)
+	if err != nil {
+		return err
+	}
+
+	enqueued, skipped := 0, 0
+	for _, participant := range participants {
+		if models.UserJobActive(app.connection, schedule.Kind, participant.UserID) {
+			skipped++
+			continue
+		}
+
+		payload, err := schedulePayload(schedule.Kind, &participant)
+		if err != nil {
+			return err
+		}
+		_, err = app.enqueueJob(schedule.Kind, participant.UserID, payload)
+		if err != nil {
+			return err
+		}
+		enqueued++
+	}
+
+	app.infoLog.Printf("Schedule %d queued %d %s jobs, skipped %d participants still in progress", schedule.ID, enqueued, schedule.Kind, skipped)
+	return models.MarkScheduleRun(app.connection, schedule.ID, enqueued, skipped)
+}
+
+// schedulePayload returns the payload a worker of the given kind expects for a participant.
+// Scheduled profile jobs only update the profile, the other stages have their own schedules.
+func schedulePayload(kind string, participant *models.Participant) (any, error) {
+	switch kind {
+	case models.JobProfile, models.JobTweets:
+		return &simplifiedUser{
+			ID:                  participant.UserID,
+			Username:            participant.Handle,
+			IsParticipant:       true,
+			ParticipantSchoolID: participant.SchoolID,
+			ParticipantCohort:   participant.Cohort,
+			StartDate:           participant.StartDate,
+			EndDate:             participant.EndDate,
+			ScrapeContent:       kind == models.JobTweets,
+		}, nil
+	case models.JobFollowers, models.JobFollowings:
+		return &models.SimpleRequest{
+			UID:                participant.UserID,
+			Username:           participant.Handle,
+			Scrape_connections: true,
+		}, nil
+	}
+	return nil, fmt.Errorf("jobs of kind %q can not be scheduled", kind)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// scoreBatchSize is how many tweets the backfill scores and stores at a time.
+const scoreBatchSize = 1000
+
+// tweetScore scores the text of a tweet for sentiment and toxicity.
+func (app *application) tweetScore(tweetID int64, text string) *models.TweetScore {
+	score := app.scorer.Score(text)
+	return &models.TweetScore{
+		TweetID:    tweetID,
+		Sentiment:  score.Sentiment,
+		Toxicity:   score.Toxicity,
+		ToxicWords: score.ToxicWords,
+		Words:      score.Words,
+		ScoredAt:   time.Now(),
+	}
+}
+
+// scoreTweets scores the tweets in the database that have no score yet, or every tweet if rescore is set, a batch at a time.
+// Returns how many tweets were scored.
+func (app *application) scoreTweets(rescore bool) (int, error) {
+	scored := 0
+	var afterID int64
+	for {
+		tweets, err := models.GetTweetsToScore(app.connection, afterID, scoreBatchSize, rescore)
+		if err != nil {
+			return scored, err
+		}
+		if len(tweets) == 0 {
+			return scored, nil
+		}
+
+		scores := make([]*models.TweetScore, len(tweets))
+		for i, tweet := range tweets {
+			scores[i] = app.tweetScore(tweet.ID, tweet.Text)
+		}
+		err = models.InsertTweetScores(app.connection, scores)
+		if err != nil {
+			return scored, err
+		}
+		scored += len(tweets)
+		afterID = tweets[len(tweets)-1].ID
+		app.infoLog.Printf("Scored %d tweets", scored)
+	}
+}
+
+// scoreTweetsCLI backfills the scores of the tweets in the database from the command line.
+// Tweets that already have a score are only scored again if the user asks for it, e.g. after the word lists changed.
+func (app *application) scoreTweetsCLI(r *bufio.Reader) {
+	fmt.Printf("\n~~Score tweets that already have a score again? (y/N)~~\n")
+	answer, _ := r.ReadString('\n')
+	rescore := strings.EqualFold(strings.TrimSpace(answer), "y")
+
+	fmt.Printf("\n~~Scoring tweets~~\n")
+	scored, err := app.scoreTweets(rescore)
+	if err != nil {
+		app.errorLog.Println(err)
+	}
+	fmt.Printf("\n~~Scored %d tweets~~\n", scored)
+}
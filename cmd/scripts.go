@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -26,14 +28,18 @@ func (app *application) resetTables() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return models.Migrate(app.connection)
 }
 
-// scrapeUser scrapes a user's twitter profile and returns a models.User struct.
-// TODO: add error checking for handles that don't exist
-func (app *application) scrapeUser(handle string) (*models.User, error) {
+// fetchUser scrapes a user's twitter profile and returns a models.User struct.  Workers go through scrapeUser or lookupUser instead,
+// so the same profile is not scraped twice at once.
+// Failures caused by the state of the account are returned as account errors, and stored on the user if they are in the database.
+func (app *application) fetchUser(ctx context.Context, handle string) (*models.User, error) {
 	app.infoLog.Printf("Scraping user %s", handle)
-	profile, err := app.scraper.GetProfile(handle)
+	profile, err := app.source.GetProfile(ctx, handle)
+	if err != nil {
+		profile, err = app.recoverProfile(ctx, handle, err)
+	}
 	if err != nil {
 		app.errorLog.Println(err)
 		return nil, err
@@ -46,7 +52,7 @@ func (app *application) scrapeUser(handle string) (*models.User, error) {
 	}
 	currTime := time.Now()
 
-	return &models.User{
+	user := &models.User{
 		ID:          uid,
 		ProfileName: profile.Name,
 		Handle:      profile.Username,
@@ -63,13 +69,94 @@ func (app *application) scrapeUser(handle string) (*models.User, error) {
 		Following:   profile.FollowingCount,
 		Followers:   profile.FollowersCount,
 		CollectedAt: &currTime,
-	}, nil
+	}
+	user.AccountState = models.AccountActive
+	if profile.IsPrivate {
+		user.AccountState = models.AccountProtected
+	}
+	//a rename is always kept in the handle history, but only marks an account that is otherwise active, so a protected account stays uncollected
+	if app.recordHandle(user) && user.AccountState == models.AccountActive {
+		user.AccountState = models.AccountRenamed
+	}
+	app.updateAccountState(user.ID, user.Handle, user.AccountState)
+	app.recordUserSnapshot(user)
+
+	return user, nil
+}
+
+// recoverProfile handles a failed profile scrape of a handle that belongs to a user in the database.
+// A handle that no longer exists is looked up by the user's id, and if the account was renamed the profile is scraped under the new handle.
+// A profile the scraper could not get without saying why is confirmed the same way before any state is stored, and is retried later if it can not be.
+// Otherwise the account state that explains the failure is stored and the error is returned.
+func (app *application) recoverProfile(ctx context.Context, handle string, err error) (twitterscraper.Profile, error) {
+	state, ok := accountStateOf(err)
+	unconfirmed := errors.Is(err, errProfileUnavailable)
+	if !ok && !unconfirmed {
+		return twitterscraper.Profile{}, err
+	}
+	uid, lookupErr := models.GetUserIDByHandle(app.connection, handle)
+	if lookupErr != nil {
+		return twitterscraper.Profile{}, err
+	}
+
+	if state == models.AccountDeleted || unconfirmed {
+		current, lookupErr := app.source.LookupUser(ctx, uid)
+		if lookupErr == nil && !strings.EqualFold(current, handle) {
+			app.infoLog.Printf("User %s not found, user %d is now %s", handle, uid, current)
+			return app.source.GetProfile(ctx, current)
+		}
+		lookupState, confirmed := accountStateOf(lookupErr)
+		switch {
+		case confirmed:
+			state = lookupState
+		case unconfirmed && lookupErr != nil:
+			return twitterscraper.Profile{}, err
+		case unconfirmed:
+			//the account still has the handle, the scraper is just not shown it
+			state = models.AccountProtected
+		}
+		if unconfirmed {
+			err = &accountError{state: state, err: err}
+		}
+	}
+
+	app.updateAccountState(uid, handle, state)
+	return twitterscraper.Profile{}, err
+}
+
+// recordHandle records the handle of a scraped profile in the user's handle history.
+// If the user is already in the database under a different handle, ignoring case, they have been renamed and their handle is updated.
+// Returns whether the user was renamed.
+func (app *application) recordHandle(user *models.User) bool {
+	stored, err := models.GetUsernameByID(app.connection, user.ID)
+	if err == nil && !strings.EqualFold(stored, user.Handle) {
+		app.infoLog.Printf("User %d renamed from %s to %s", user.ID, stored, user.Handle)
+		err = models.UpdateUserHandle(app.connection, user)
+		if err != nil {
+			app.errorLog.Printf("Error updating handle of %s: %s", user.Handle, err)
+		}
+		return true
+	}
+	err = models.RecordHandle(app.connection, user.ID, user.Handle, time.Now())
+	if err != nil {
+		app.errorLog.Printf("Error recording handle of %s: %s", user.Handle, err)
+	}
+	return false
+}
+
+// recordUserSnapshot stores a snapshot of a scraped profile, so the history of the profile is kept when the user is updated.
+// Unless snapshotAlways is set, the snapshot is only stored when the profile changed since the last one.
+func (app *application) recordUserSnapshot(user *models.User) {
+	_, err := models.InsertUserSnapshot(app.connection, models.NewUserSnapshot(user), !app.snapshotAlways)
+	if err != nil {
+		app.errorLog.Printf("Error storing profile snapshot of %s: %s", user.Handle, err)
+	}
 }
 
 // addOrUpdateUser adds a user to the database if it doesn't already exist.
 // If the user already exists, it updates the user's information.
 func (app *application) addOrUpdateUser(user *models.User) error {
-	if !models.UserExists(app.connection, user.Handle) { //inserts user if they don't exist in the database
+	if !models.UserIDExists(app.connection, user.ID) { //inserts user if they don't exist in the database
 		err := models.InsertUser(app.connection, user)
 		if err != nil {
 			return err
@@ -108,42 +195,50 @@ func (app *application) getAllUsernames() []string {
 	return usernames
 }
 
-// ScrapeTweets scrapes a user's tweets and returns a slice of twitterscraper.Tweet structs.
-// Note: Some retweets may be shortened.
-func (app *application) scrapeTweets(handle string, from time.Time) []*twitterscraper.Tweet {
-	cursor := ""
-	var tweets []*twitterscraper.Tweet
-	var err error
-	var tweetsSlice []*twitterscraper.Tweet //Slice to return
-	numTweets := 0
-	tweets, cursor, err = app.scraper.FetchTweets(handle, 200, cursor)
-	if err != nil {
-		app.errorLog.Println(err)
-	}
-	for tweets != nil {
+// tweetPageSize is how many tweets of a timeline are asked for at a time.
+const tweetPageSize = 200
 
-		for _, tweet := range tweets {
+// collectTweets pages through the timeline of a user, newest first, starting at cursor until it reaches the tweets posted before from.
+// Every page is passed to onPage as soon as it arrives, with the tweets of the page that are in the window and the cursor of the following page.
+// Tweets after until are skipped, unless until is the zero time.  Paging stops at the first error of the source or of onPage, which is returned.
+func (app *application) collectTweets(ctx context.Context, handle string, cursor string, from time.Time, until time.Time, onPage func(tweets []*twitterscraper.Tweet, next string) error) error {
+	for {
+		page, next, err := app.source.FetchTweets(ctx, handle, tweetPageSize, cursor)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
 
-			//Checks if tweet is older than from date.  If it is, all remaining tweets are skipped.
-			//scrapeTweets returns.
+		var tweets []*twitterscraper.Tweet
+		reachedFrom := false
+		for _, tweet := range page {
+			//a pinned tweet is out of order, so it never ends the timeline
+			if tweet.IsPin && tweet.TimeParsed.Before(from) {
+				continue
+			}
+			//the rest of the timeline is older than from
 			if tweet.TimeParsed.Before(from) {
-				app.infoLog.Printf("%d tweets scraped from %s", numTweets, handle)
-				return tweetsSlice
+				reachedFrom = true
+				break
 			}
-
-			tweetsSlice = append(tweetsSlice, tweet)
-			numTweets++
-
+			//tweets after the end of the study window are skipped, older tweets are still on the next pages
+			if !until.IsZero() && tweet.TimeParsed.After(until) {
+				continue
+			}
+			tweets = append(tweets, tweet)
 		}
 
-		tweets, cursor, err = app.scraper.FetchTweets(handle, 200, cursor)
+		err = onPage(tweets, next)
 		if err != nil {
-			app.errorLog.Println(err)
+			return err
+		}
+		if reachedFrom || next == "" {
+			return nil
 		}
+		cursor = next
 	}
-	//returns slice of models.tweet structs if finished scraping and from date is never reached.
-	app.infoLog.Printf("%d tweets scraped from %s", numTweets, handle)
-	return tweetsSlice
 }
 
 // guessGender guesses the user's gender by looking for personal pronouns.
@@ -189,37 +284,6 @@ func isPerson(bio string) bool {
 	return true
 }
 
-// getMentions returns a slice of strings of the handles of users mentioned in a tweet.
-func getMentions(text string) []string {
-	mentions := []string{}
-	words := strings.Split(strings.ToLower(text), " ")
-	//removes the retweeted's handle from the list of mentions
-	if len(words) > 1 {
-		if words[0] == "rt" {
-			words = words[2:]
-		}
-	}
-
-	for _, curr := range words {
-		if strings.HasPrefix(curr, "@") {
-			curr = strings.TrimPrefix(curr, "@")
-			curr = strings.Replace(curr, ",", "", 1)
-			curr = strings.Replace(curr, ".", "", 1)
-			curr = strings.Replace(curr, "!", "", 1)
-			curr = strings.Replace(curr, "?", "", 1)
-			curr = strings.Replace(curr, ":", "", 1)
-			curr = strings.Replace(curr, ";", "", 1)
-			curr = strings.Replace(curr, "…", "", 1)
-			i := strings.Index(curr, "'")
-			if i != -1 {
-				curr = curr[:i]
-			}
-			mentions = append(mentions, curr)
-		}
-	}
-	return mentions
-}
-
 // getBioTags scrapes the handles of users mentioned in a biography
 func getBioTags(bio string) []string {
 	tags := []string{}
@@ -236,292 +300,321 @@ func getBioTags(bio string) []string {
 
 }
 
-// scrapeMentions scrapes the users mentioned in a tweet
-// returns a slice of models.user structs of users mentioned in the tweet that do not exist in the database
-// and a slice of models.mention structs of mentions that do not exist in the database
-// Skips mentions in retweets by default.
-// TODO Parralelize
-func (app *application) scrapeMentions(tweets []*twitterscraper.Tweet, scrapeRetweets ...bool) ([]*models.User, []*models.Mention) {
-
-	//By default, retweets are skipped
-	scrapeRT := false
-	if len(scrapeRetweets) > 0 {
-		scrapeRT = scrapeRetweets[0]
-	}
-
-	var userSlice []*models.User
-	var mentionSlice []*models.Mention
-
-	re := regexp.MustCompile("@")
-
-	for _, tweet := range tweets {
-		if tweet.IsRetweet && !scrapeRT {
-			continue
-		}
-		if re.MatchString(tweet.Text) {
-			var currUser *models.User
-			var err error
-			tweetID, err := strconv.ParseInt(tweet.ID, 10, 64)
-			if err != nil {
-				app.errorLog.Println(err)
-				//mention is skipped if there is an issue with the tweetID
-				continue
-			}
-			mentions := getMentions(tweet.Text)
-			for _, mention := range mentions {
-				app.infoLog.Printf("Scraped mention %s", mention)
-				//checks to make sure user doesn't already exist before adding
-				if !models.UserExists(app.connection, mention) {
-					currUser, err = app.scrapeUser(mention)
-					if err != nil {
-						app.errorLog.Println("Error scraping user: ", err)
-					} else {
-						//Only user mention if user was successfully scraped
-						userSlice = append(userSlice, currUser)
-						toInsert := models.Mention{
-							UserID:  currUser.ID,
-							TweetID: tweetID,
-						}
-						//Only adds mention if user was successfully scraped
-						//checks to make sure mention doesn't already exist before adding
-						if !models.MentionExists(app.connection, &toInsert) {
-							mentionSlice = append(mentionSlice, &toInsert)
-						}
-					}
-				}
-			}
-		}
-	}
-	return userSlice, mentionSlice
-}
-
-// add Reply transforms a twitterscraper.Tweet to a models.Reply and adds it to the database
-func (app *application) addReply(tweet *twitterscraper.Tweet) error {
+// addTweet transforms a twitterscraper.Tweet object into a tweet graph and adds it to the database in a single transaction
+// the tweets it replies to, retweets or quotes are added with it if they do not already exist, together with its hashtags and reply edge
+// a tweet that already exists only has its engagement updated
+func (app *application) addTweet(ctx context.Context, tweet *twitterscraper.Tweet) error {
 	tweetID, err := strconv.ParseInt(tweet.ID, 10, 64)
 	if err != nil {
 		app.errorLog.Println(err)
 		return err
 	}
-	userRepliedToID, err := strconv.ParseInt(tweet.InReplyToStatus.UserID, 10, 64)
-	if err != nil {
-		app.errorLog.Println(err)
-		return err
-	}
-	//checks if userRepliedToID is in the database. If not, it is scraped.
-	if !models.UserIDExists(app.connection, userRepliedToID) {
-		userToAdd, err := app.scrapeUser(tweet.InReplyToStatus.Username)
-		if err != nil {
-			app.errorLog.Println("addReply: Error scraping user: ", err)
-			return err
-		}
-		err = models.InsertUser(app.connection, userToAdd)
+
+	//does not add tweet if it already exists in database, only its engagement is updated
+	//its links and media are added too, so tweets collected before links were kept get them when they are seen again
+	if models.TweetExists(app.connection, tweetID) {
+		now := time.Now()
+		err = models.UpdateTweetEngagement(app.connection, &models.Tweet{
+			ID:          tweetID,
+			Likes:       tweet.Likes,
+			Retweets:    tweet.Retweets,
+			Replies:     tweet.Replies,
+			CollectedAt: &now,
+		})
 		if err != nil {
-			app.errorLog.Println("addReply: Error inserting user: ", err)
 			return err
 		}
+		urls, media := tweetLinks(tweet, tweetID)
+		return models.InsertTweetLinks(app.connection, urls, media)
 	}
-	toAdd := models.Reply{
-		TweetID: tweetID,
-		ReplyID: userRepliedToID,
-	}
-	return models.InsertReply(app.connection, &toAdd)
-}
 
-// updateReplies checks if the reply exists in the database before adding it
-// also adds user replied to if they do not exist.
-func (app *application) updateReplies(replies []*models.Reply) error {
-	for _, reply := range replies {
-		if !models.ReplyExists(app.connection, reply) {
-			err := models.InsertReply(app.connection, reply)
-			if err != nil {
-				app.errorLog.Println(err)
-				return err
-			}
-		}
+	graph, err := app.tweetGraph(ctx, tweet)
+	if err != nil {
+		app.errorLog.Println("addTweet:", err)
+		return err
+	}
+	err = models.SaveTweetGraph(app.connection, graph)
+	if err != nil {
+		app.errorLog.Println("addTweet: Error saving tweet:", err)
+		return err
 	}
 	return nil
 }
 
-// addTweet transforms a twitterscraper.Tweet object into a models.Tweet object and adds it to the database
-// checks if the tweet is a retweet, if it is, the retweet is added to the database if it does not already exist
-// also adds hashtags
-func (app *application) addTweet(tweet *twitterscraper.Tweet) error {
-
+// tweetGraph builds the tweet graph of a tweet that is not in the database yet.  Users the graph needs are looked up before anything is stored,
+// so no transaction is held open while profiles are scraped.  A referenced tweet that can not be added is left out of the graph,
+// the tweet is still added without it.
+func (app *application) tweetGraph(ctx context.Context, tweet *twitterscraper.Tweet) (*models.TweetGraph, error) {
 	now := time.Now()
+	graph := &models.TweetGraph{}
 
 	tweetID, err := strconv.ParseInt(tweet.ID, 10, 64)
 	if err != nil {
-		app.errorLog.Println(err)
-		return err
-	}
-
-	//does not add tweet if it already exists in database
-	if models.TweetExists(app.connection, tweetID) {
-		return nil
+		return nil, err
 	}
-
 	tweetUserID, err := strconv.ParseInt(tweet.UserID, 10, 64)
 	if err != nil {
-		app.errorLog.Println(err)
-		return err
+		return nil, err
 	}
 
 	//checks if user is in the database. If not, it is scraped.
-	if !models.UserIDExists(app.connection, tweetUserID) {
-		userToAdd, err := app.scrapeUser(tweet.Username)
-		if err != nil {
-			app.errorLog.Println("addTweet: Error scraping user: ", err)
-			return err
-		}
-		err = models.InsertUser(app.connection, userToAdd)
-		if err != nil {
-			app.errorLog.Println(err)
-			return err
-		}
+	err = app.addGraphAuthor(ctx, graph, tweetUserID, tweet.Username)
+	if err != nil {
+		return nil, fmt.Errorf("error scraping user %s: %w", tweet.Username, err)
 	}
 
-	var conversationID int64 = tweetID //default is tweetID
-	if tweet.IsReply {                 //todo: add reply to database if it does not already exist
-		if tweet.InReplyToStatus != nil { //Extra check to make sure there actually is a tweet object
-			app.addTweet(tweet.InReplyToStatus)
-			app.addReply(tweet)
-			conversationID, err = strconv.ParseInt(tweet.InReplyToStatus.ID, 10, 64)
+	//a tweet that is not a reply is the root of its own conversation
+	var conversationID int64 = tweetID
+	if tweet.IsReply && tweet.InReplyToStatus != nil { //Extra check to make sure there actually is a tweet object
+		parentID, ok := app.addReferencedTweet(ctx, graph, tweet.InReplyToStatus)
+		if ok {
+			//a reply belongs to the conversation of the tweet it replies to
+			conversationID, err = app.conversationOf(graph, parentID)
 			if err != nil {
-				app.errorLog.Println(err)
-				return err
+				return nil, err
 			}
-		}
-	}
-
-	var retweetID *int64
-	if tweet.IsRetweet { //todo add retweet to database if it does not already exist
-		if tweet.RetweetedStatus != nil { //Extra check to make sure there actually is a tweet object
-			app.addTweet(tweet.RetweetedStatus)
-			retweetIDint, err := strconv.ParseInt(tweet.RetweetedStatus.ID, 10, 64)
+			//the user replied to is the author of the parent tweet, so they are in the graph or the database already
+			userRepliedToID, err := strconv.ParseInt(tweet.InReplyToStatus.UserID, 10, 64)
 			if err != nil {
-				app.errorLog.Println(err)
-				return err
+				return nil, err
 			}
-			retweetID = &retweetIDint
-		}
-	} else if tweet.IsQuoted {
-		if tweet.QuotedStatus != nil { //Extra check to make sure there actually is a tweet object
-			app.addTweet(tweet.QuotedStatus)
-			retweetIDint, err := strconv.ParseInt(tweet.QuotedStatus.ID, 10, 64)
-			if err != nil {
-				app.errorLog.Println(err)
-				return err
+			graph.Reply = &models.Reply{
+				TweetID:       tweetID,
+				ReplyID:       userRepliedToID,
+				ParentTweetID: parentID,
 			}
-			retweetID = &retweetIDint
 		}
 	}
 
-	toAdd := &models.Tweet{
-		ID:             tweetID,
-		ConversationID: conversationID,
-		Text:           tweet.Text,
-		PostedAt:       &tweet.TimeParsed,
-		Url:            tweet.PermanentURL,
-		UserID:         tweetUserID,
-		IsRetweet:      tweet.IsRetweet,
-		RetweetID:      retweetID,
-		Likes:          tweet.Likes,
-		Retweets:       tweet.Retweets,
-		Replies:        tweet.Replies,
-		CollectedAt:    &now,
+	//a tweet can retweet, quote and reply at the same time, each reference is kept in its own column
+	var retweetedID, quotedID *int64
+	if tweet.IsRetweet && tweet.RetweetedStatus != nil {
+		if referencedID, ok := app.addReferencedTweet(ctx, graph, tweet.RetweetedStatus); ok {
+			retweetedID = &referencedID
+		}
+	}
+	if tweet.IsQuoted && tweet.QuotedStatus != nil {
+		if referencedID, ok := app.addReferencedTweet(ctx, graph, tweet.QuotedStatus); ok {
+			quotedID = &referencedID
+		}
 	}
 
-	//Adds tweet to database
-	err = models.InsertTweet(app.connection, toAdd)
-	if err != nil {
-		app.errorLog.Println(err)
-		return err
+	graph.Tweet = &models.Tweet{
+		ID:               tweetID,
+		ConversationID:   conversationID,
+		Text:             tweet.Text,
+		PostedAt:         &tweet.TimeParsed,
+		Url:              tweet.PermanentURL,
+		UserID:           tweetUserID,
+		IsRetweet:        tweet.IsRetweet,
+		RetweetedTweetID: retweetedID,
+		QuotedTweetID:    quotedID,
+		Type:             models.TweetType(tweet.IsRetweet, tweet.IsQuoted, tweet.IsReply),
+		Likes:            tweet.Likes,
+		Retweets:         tweet.Retweets,
+		Replies:          tweet.Replies,
+		CollectedAt:      &now,
 	}
 
-	//must insert tweet before inserting hashtag because it references tweet.ID
-	//Adds hashtags to database
 	for _, hashtag := range tweet.Hashtags {
-		hashtagToAdd := &models.Hashtag{
+		graph.Hashtags = append(graph.Hashtags, &models.Hashtag{
 			Hashtag: hashtag,
 			TweetID: tweetID,
+		})
+	}
+	//mentions in a retweet are the retweeted author's, so they are left out
+	if !tweet.IsRetweet {
+		err = app.addGraphMentions(ctx, graph, tweetID, getMentions(tweet))
+		if err != nil {
+			return nil, err
+		}
+	}
+	graph.URLs, graph.Media = tweetLinks(tweet, tweetID)
+	graph.Score = app.tweetScore(tweetID, tweet.Text)
+
+	return graph, nil
+}
+
+// addReferencedTweet adds the graph of a tweet that graph replies to, retweets or quotes, unless it is already in the database.
+// Returns the ID of the referenced tweet, and false if it can not be added.
+func (app *application) addReferencedTweet(ctx context.Context, graph *models.TweetGraph, referenced *twitterscraper.Tweet) (int64, bool) {
+	referencedID, err := strconv.ParseInt(referenced.ID, 10, 64)
+	if err != nil {
+		app.errorLog.Println(err)
+		return 0, false
+	}
+	if models.TweetExists(app.connection, referencedID) {
+		return referencedID, true
+	}
+	referencedGraph, err := app.tweetGraph(ctx, referenced)
+	if err != nil {
+		app.errorLog.Printf("Error adding referenced tweet %d: %s", referencedID, err)
+		return 0, false
+	}
+	graph.Referenced = append(graph.Referenced, referencedGraph)
+	return referencedID, true
+}
+
+// conversationOf returns the conversation of a tweet that graph refers to, from the graph if the tweet is added with it,
+// otherwise from the database.
+func (app *application) conversationOf(graph *models.TweetGraph, tweetID int64) (int64, error) {
+	for _, referenced := range graph.Referenced {
+		if referenced.Tweet.ID == tweetID {
+			return referenced.Tweet.ConversationID, nil
 		}
-		if !models.HashtagExists(app.connection, hashtagToAdd) {
+	}
+	return models.GetConversationID(app.connection, tweetID)
+}
+
+// addGraphAuthor adds a user to the authors of a tweet graph, unless they are already in the database.
+func (app *application) addGraphAuthor(ctx context.Context, graph *models.TweetGraph, userID int64, handle string) error {
+	if models.UserIDExists(app.connection, userID) {
+		return nil
+	}
+	user, err := app.lookupUser(ctx, handle)
+	if err != nil {
+		return err
+	}
+	graph.Authors = append(graph.Authors, user)
+	return nil
+}
+
+// addGraphMentions adds the mentions of a tweet to its graph.  The mentioned handles are resolved to users in one query,
+// and only users that are not in the database are looked up and added to the authors of the graph.
+// A mentioned user that can not be looked up is left out, the tweet is still added without the mention.
+func (app *application) addGraphMentions(ctx context.Context, graph *models.TweetGraph, tweetID int64, handles []string) error {
+	if len(handles) == 0 {
+		return nil
+	}
+	IDs, err := models.ResolveHandles(app.connection, handles)
+	if err != nil {
+		return fmt.Errorf("error resolving mentions: %w", err)
+	}
 
-			err = models.InsertHashtag(app.connection, hashtagToAdd)
+	for _, handle := range handles {
+		ID, ok := IDs[handle]
+		if !ok {
+			user, err := app.lookupUser(ctx, handle)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			if err != nil {
-				app.errorLog.Println(err)
-				return err
+				app.errorLog.Println("Error scraping mentioned user: ", err)
+				continue
 			}
+			ID = user.ID
+			graph.Authors = append(graph.Authors, user)
 		}
+		graph.Mentions = append(graph.Mentions, &models.Mention{
+			TweetID: tweetID,
+			UserID:  ID,
+		})
 	}
-
 	return nil
 }
 
 // updateTweets updates the database with new tweets
-func (app *application) updateTweets(tweets []*twitterscraper.Tweet) error {
+func (app *application) updateTweets(ctx context.Context, tweets []*twitterscraper.Tweet) error {
 
 	for _, tweet := range tweets {
+		//stops between tweets on shutdown, the tweets stored so far are kept
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
-		app.addTweet(tweet)
-
+		err := app.addTweet(ctx, tweet)
+		if err != nil {
+			return fmt.Errorf("error adding tweet %s: %w", tweet.ID, err)
+		}
 	}
-	//Fetches
 	return nil
 }
 
 // updateFollows updates the database with the new follows
 // also updates the database with the new users
-func (app *application) updateFollows(follows []*models.Follow) error {
+// every follow is marked as seen at seenAt, new follows are recorded as gained if recordNew is set
+// The users of the page are checked with one query and the follows are stored in one batch.
+func (app *application) updateFollows(ctx context.Context, follows []*models.Follow, seenAt time.Time, recordNew bool) error {
+	var ids []int64
 	for _, follow := range follows {
-		//check if the follow already exists in the database
-		if !models.FollowExists(app.connection, follow) {
-			//checks if the Followee exists in the database
-			if !models.UserIDExists(app.connection, follow.FolloweeID) {
-				//scrapes the user if it doesn't exist in the database
-				user, err := app.scrapeUser(follow.FolloweeUsername)
-				if err != nil {
-					app.errorLog.Println("Error scraping user: ", err)
-					app.errorLog.Println(err)
-				}
-				//adds the user to the database
-				err = models.InsertUser(app.connection, user)
-				if err != nil {
-					app.errorLog.Println("Error inserting user: ", err)
-					app.errorLog.Println(err)
-				}
-			}
-			//checks if the Follower exists in the database
-			if !models.UserIDExists(app.connection, follow.FollowerID) {
-				//scrapes the user if it doesn't exist in the database
-				user, err := app.scrapeUser(follow.FollowerUsername)
-				if err != nil {
-					app.errorLog.Println("Error scraping user: ", err)
-					app.errorLog.Println(err)
-				}
-				//adds the user to the database
-				err = models.InsertUser(app.connection, user)
-				if err != nil {
-					app.errorLog.Println("Error inserting user: ", err)
-					app.errorLog.Println(err)
-				}
-			}
+		ids = append(ids, follow.FollowerID, follow.FolloweeID)
+	}
+	existing, err := models.UserIDsExist(app.connection, ids)
+	if err != nil {
+		return err
+	}
 
-			err := models.InsertFollow(app.connection, follow)
-			if err != nil {
-				app.errorLog.Println(err)
-				return err
-			}
+	stored := make([]*models.Follow, 0, len(follows))
+	for _, follow := range follows {
+		//stops between follows on shutdown, the page is not checkpointed so it is scraped again on resume
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		//scrapes the users that don't exist in the database, the follow can not be stored without them
+		if !app.ensureUser(ctx, existing, follow.FolloweeID, follow.FolloweeUsername) || !app.ensureUser(ctx, existing, follow.FollowerID, follow.FollowerUsername) {
+			continue
+		}
+		stored = append(stored, follow)
+	}
+
+	err = models.ObserveFollows(app.connection, stored, seenAt, recordNew)
+	if err != nil {
+		app.errorLog.Println(err)
+		return err
 	}
 	return nil
 }
 
+// ensureUser adds a user that is not in existing to the database, and to existing.  The user is looked up by handle, or by ID if the handle
+// now belongs to another account, so existing only ever holds IDs that are in the database.  Returns false if the user could not be added.
+func (app *application) ensureUser(ctx context.Context, existing map[int64]bool, ID int64, handle string) bool {
+	if existing[ID] {
+		return true
+	}
+	user, err := app.lookupUser(ctx, handle)
+	if err == nil && user.ID != ID {
+		//the handle has moved to another account since the follow list was fetched, so the account is looked up by its id
+		user, err = app.lookupUserByID(ctx, ID)
+	}
+	if err != nil {
+		app.errorLog.Println("Error scraping user: ", err)
+		return false
+	}
+	//adds the user to the database
+	err = models.InsertUser(app.connection, user)
+	if err != nil {
+		app.errorLog.Println("Error inserting user: ", err)
+		//another worker may have added the user in the meantime
+		if !models.UserIDExists(app.connection, ID) {
+			return false
+		}
+	}
+	existing[ID] = true
+	return true
+}
+
+// lookupUserByID looks up the profile of the account with the given id under its current handle.
+// Returns an error if the profile found is not the account's, e.g. when the account was renamed again in between.
+func (app *application) lookupUserByID(ctx context.Context, ID int64) (*models.User, error) {
+	handle, err := app.source.LookupUser(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := app.lookupUser(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID != ID {
+		return nil, fmt.Errorf("handle %s of user %d belongs to user %d", handle, ID, user.ID)
+	}
+	return user, nil
+}
+
 // addSchool adds a school in the database.  It will also assign the school an ID.
-func (app *application) addSchool(school *simplifiedSchool) error {
+func (app *application) addSchool(ctx context.Context, school *simplifiedSchool) error {
 	var toAdd models.School
 
-	user, err := app.scrapeUser(school.TwitterHandle)
+	user, err := app.scrapeUser(ctx, school.TwitterHandle)
 	if err != nil {
 		app.errorLog.Println(err)
 		return err
@@ -557,14 +650,12 @@ func (app *application) addSchool(school *simplifiedSchool) error {
 	return nil
 }
 
-// addBioTag adds a biotag to the database, checks if it already exists
-func (app *application) addBioTag(bioTag *models.BioTag) error {
-	if !models.TagExists(app.connection, bioTag.UserID, bioTag.MentionedUserID) {
-		err := models.InsertBioTag(app.connection, bioTag)
-		if err != nil {
-			app.errorLog.Println(err)
-			return err
-		}
+// addBioTags adds the biotags of a user to the database in one batch, biotags that already exist are skipped
+func (app *application) addBioTags(bioTags []*models.BioTag) error {
+	err := models.InsertBioTags(app.connection, bioTags)
+	if err != nil {
+		app.errorLog.Println(err)
+		return err
 	}
 	return nil
 }
@@ -572,41 +663,17 @@ func (app *application) addBioTag(bioTag *models.BioTag) error {
 // converts the simplifiedUser to a simple request.  All unnecessary fields are removed
 func simpleUsertoSimpleRequest(user *simplifiedUser) *models.SimpleRequest {
 	return &models.SimpleRequest{
-		ID:                 user.BackupID,
 		UID:                user.ID,
 		Username:           user.Username,
 		Scrape_connections: user.ScrapeConnections,
 	}
 }
 
-// converts the simple request to a simplified user.
-func simpleRequstToSimpleUser(request *models.SimpleRequest) *simplifiedUser {
-	return &simplifiedUser{
-		ID:                request.UID,
-		Username:          request.Username,
-		ScrapeConnections: request.Scrape_connections,
-		BackupID:          request.ID,
-	}
-}
-
-func (app *application) populateFollowQueue(users []*models.SimpleRequest) {
-	for _, user := range users {
-		app.followChan <- user
-	}
-}
-
-func (app *application) populateFollowerQueue(users []*models.SimpleRequest) {
-	for _, user := range users {
-		app.followerChan <- user
-	}
-}
-
 // populateConnectionRequest takes a models.ConnectionRequest, queries the proper followers/followings and creates a connectionRequest struct
-func (app *application) populateConnectionRequest(request *models.ConnectionRequest) *connectionsRequest {
+func (app *application) populateConnectionRequest(request *models.ConnectionRequest) (*connectionsRequest, error) {
 	var follows []*models.Follow
 	var err error
 	populatedRequest := &connectionsRequest{
-		ID:    request.ID,
 		users: request.FollowsOrFollowers,
 	}
 	if request.FollowsOrFollowers == "follows" {
@@ -614,65 +681,18 @@ func (app *application) populateConnectionRequest(request *models.ConnectionRequ
 		//query for follows
 		follows, err = models.GetFollows(app.connection, request.UID)
 		if err != nil {
-			app.errorLog.Println("Error: " + err.Error())
-			return nil
+			return nil, err
 		}
 	} else if request.FollowsOrFollowers == "followers" {
 		populatedRequest.users = "followers"
 		//query for followers
 		follows, err = models.GetFollowers(app.connection, request.UID)
 		if err != nil {
-			app.errorLog.Println("Error: " + err.Error())
-			return nil
+			return nil, err
 		}
 	}
 
 	populatedRequest.follows = follows
 
-	return populatedRequest
-}
-
-func (app *application) loadBackups() {
-	//Query database for all follower_requests
-	requests, err := models.GetSimpleRequests(app.connection, "followers")
-	if err != nil {
-		app.errorLog.Println("Error: " + err.Error())
-		return
-	}
-	//check if there are any requests
-	if len(requests) > 0 {
-		//populate the follower queue
-		app.populateFollowerQueue(requests)
-	}
-
-	//Query database for all follow_requests
-	requests, err = models.GetSimpleRequests(app.connection, "follows")
-	if err != nil {
-		app.errorLog.Println("Error: " + err.Error())
-		return
-	}
-	//check if there are any requests
-	if len(requests) > 0 {
-		//populate the follow queue
-		app.populateFollowQueue(requests)
-	}
-
-	//Query database for all connection_requests
-	connectionRequests, err := models.GetConnectionRequests(app.connection)
-	if err != nil {
-		app.errorLog.Println("Error: " + err.Error())
-		return
-	}
-	//check if there are any requests
-	if len(connectionRequests) == 0 {
-		app.infoLog.Printf("no connection requests found")
-		return
-	}
-
-	//populate the connection reqeusts
-	for _, request := range connectionRequests {
-		app.infoLog.Printf("Loading connection request: %v", request.ID)
-		app.connectionsChan <- *app.populateConnectionRequest(request)
-	}
-
+	return populatedRequest, nil
 }
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	twitterscraper "github.com/n0madic/twitter-scraper"
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// TwitterSource is everything the workers need from twitter.  Workers only talk to twitter through this interface,
+// so the pipeline can be run against the live site or against fixtures without changing any worker logic.
+// Every method returns ctx.Err() as soon as ctx is cancelled.
+type TwitterSource interface {
+	// GetProfile returns the profile of the user with the given handle.
+	GetProfile(ctx context.Context, handle string) (twitterscraper.Profile, error)
+	// FetchTweets returns up to count tweets from a user's timeline starting at cursor, and the cursor of the next page.
+	FetchTweets(ctx context.Context, handle string, count int, cursor string) ([]*twitterscraper.Tweet, string, error)
+	// FollowersPage returns a page of follows of users that follow the given user starting at pageToken,
+	// and the token of the next page, which is empty on the last page.
+	FollowersPage(ctx context.Context, user *models.SimpleRequest, pageToken string) ([]*models.Follow, string, error)
+	// FollowingsPage returns a page of follows of users that the given user follows starting at pageToken,
+	// and the token of the next page, which is empty on the last page.
+	FollowingsPage(ctx context.Context, user *models.SimpleRequest, pageToken string) ([]*models.Follow, string, error)
+	// LookupUser returns the current handle of the user with the given id.
+	LookupUser(ctx context.Context, uid int64) (string, error)
+}
+
+// liveSource is the TwitterSource backed by the n0madic scraper for profiles and timelines
+// and the twitter v2 api for followers and followings.
+type liveSource struct {
+	scraper  *twitterscraper.Scraper
+	client   http.Client
+	tokens   *tokenPool
+	errorLog *log.Logger
+	infoLog  *log.Logger
+	debug    bool
+}
+
+// newLiveSource creates a liveSource.  v2 api requests are spread over the tokens in the pool.
+func newLiveSource(tokens *tokenPool, infoLog, errorLog *log.Logger) *liveSource {
+	return &liveSource{
+		scraper:  twitterscraper.New(),
+		client:   http.Client{},
+		tokens:   tokens,
+		errorLog: errorLog,
+		infoLog:  infoLog,
+	}
+}
+
+// GetProfile returns the profile of a user from the scraper.
+func (src *liveSource) GetProfile(ctx context.Context, handle string) (twitterscraper.Profile, error) {
+	type result struct {
+		profile twitterscraper.Profile
+		err     error
+	}
+	//the scraper does not take a context, so the call is abandoned instead of stopped when ctx is cancelled
+	done := make(chan result, 1)
+	go func() {
+		profile, err := src.scraper.GetProfile(handle)
+		if err != nil {
+			err = classifyProfileError(err)
+		}
+		done <- result{profile, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.profile, res.err
+	case <-ctx.Done():
+		return twitterscraper.Profile{}, ctx.Err()
+	}
+}
+
+// FetchTweets returns a page of a user's timeline from the scraper.
+func (src *liveSource) FetchTweets(ctx context.Context, handle string, count int, cursor string) ([]*twitterscraper.Tweet, string, error) {
+	type result struct {
+		tweets []*twitterscraper.Tweet
+		next   string
+		err    error
+	}
+	//the scraper does not take a context, so the call is abandoned instead of stopped when ctx is cancelled
+	done := make(chan result, 1)
+	go func() {
+		tweets, next, err := src.scraper.FetchTweets(handle, count, cursor)
+		done <- result{tweets, next, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.tweets, res.next, res.err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+// fixturePageSize is the number of followers or followings in a page of a fixture, the same as a page of the v2 api.
+const fixturePageSize = 1000
+
+// fixtureUser is an account in a follower or following list of a fixture.
+type fixtureUser struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// fixtureFile is the layout of a fixture file loaded by loadFixtureSource.
+// tweets are keyed by handle, followers and followings are keyed by user id.
+type fixtureFile struct {
+	Profiles   []twitterscraper.Profile           `json:"profiles"`
+	Tweets     map[string][]*twitterscraper.Tweet `json:"tweets"`
+	Followers  map[string][]fixtureUser           `json:"followers"`
+	Followings map[string][]fixtureUser           `json:"followings"`
+}
+
+// fixtureSource is an in-memory TwitterSource.  It is used to run the workers without touching twitter,
+// either filled from a fixture file or directly through its Add methods.
+type fixtureSource struct {
+	mu         sync.RWMutex
+	profiles   map[string]twitterscraper.Profile
+	tweets     map[string][]*twitterscraper.Tweet
+	followers  map[int64][]fixtureUser
+	followings map[int64][]fixtureUser
+}
+
+// newFixtureSource creates an empty fixtureSource.
+func newFixtureSource() *fixtureSource {
+	return &fixtureSource{
+		profiles:   make(map[string]twitterscraper.Profile),
+		tweets:     make(map[string][]*twitterscraper.Tweet),
+		followers:  make(map[int64][]fixtureUser),
+		followings: make(map[int64][]fixtureUser),
+	}
+}
+
+// loadFixtureSource creates a fixtureSource from a json fixture file.
+func loadFixtureSource(path string) (*fixtureSource, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file fixtureFile
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	src := newFixtureSource()
+	for _, profile := range file.Profiles {
+		src.AddProfile(profile)
+	}
+	for handle, tweets := range file.Tweets {
+		src.AddTweets(handle, tweets)
+	}
+	for id, users := range file.Followers {
+		uid, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid follower fixture id %q: %w", id, err)
+		}
+		src.AddFollowers(uid, users)
+	}
+	for id, users := range file.Followings {
+		uid, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid following fixture id %q: %w", id, err)
+		}
+		src.AddFollowings(uid, users)
+	}
+	return src, nil
+}
+
+// AddProfile adds a profile to the fixtures, replacing any profile with the same handle.
+func (src *fixtureSource) AddProfile(profile twitterscraper.Profile) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.profiles[strings.ToLower(profile.Username)] = profile
+}
+
+// AddTweets appends tweets to a user's timeline.  Tweets are expected newest first, like the scraper returns them.
+func (src *fixtureSource) AddTweets(handle string, tweets []*twitterscraper.Tweet) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	handle = strings.ToLower(handle)
+	src.tweets[handle] = append(src.tweets[handle], tweets...)
+}
+
+// AddFollowers adds users that follow the user with the given id.
+func (src *fixtureSource) AddFollowers(uid int64, users []fixtureUser) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.followers[uid] = append(src.followers[uid], users...)
+}
+
+// AddFollowings adds users that the user with the given id follows.
+func (src *fixtureSource) AddFollowings(uid int64, users []fixtureUser) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.followings[uid] = append(src.followings[uid], users...)
+}
+
+// GetProfile returns the fixture profile for a handle.
+func (src *fixtureSource) GetProfile(ctx context.Context, handle string) (twitterscraper.Profile, error) {
+	if err := ctx.Err(); err != nil {
+		return twitterscraper.Profile{}, err
+	}
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+	profile, ok := src.profiles[strings.ToLower(handle)]
+	if !ok {
+		return twitterscraper.Profile{}, classifyProfileError(fmt.Errorf("either @%s does not exist or is private", handle))
+	}
+	return profile, nil
+}
+
+// LookupUser returns the handle of the fixture profile with the given id.
+func (src *fixtureSource) LookupUser(ctx context.Context, uid int64) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+	id := strconv.FormatInt(uid, 10)
+	for _, profile := range src.profiles {
+		if profile.UserID == id {
+			return profile.Username, nil
+		}
+	}
+	return "", &accountError{state: models.AccountDeleted, err: fmt.Errorf("user %d not found", uid)}
+}
+
+// FetchTweets returns a page of a fixture timeline.  The cursor is the index of the first tweet of the page.
+func (src *fixtureSource) FetchTweets(ctx context.Context, handle string, count int, cursor string) ([]*twitterscraper.Tweet, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+	tweets := src.tweets[strings.ToLower(handle)]
+
+	if count < 1 {
+		return nil, "", fmt.Errorf("invalid fixture page size %d", count)
+	}
+	start := 0
+	if cursor != "" {
+		var err error
+		start, err = strconv.Atoi(cursor)
+		if err != nil || start < 0 {
+			return nil, "", fmt.Errorf("invalid fixture cursor %q", cursor)
+		}
+	}
+	if start >= len(tweets) {
+		return nil, "", nil
+	}
+	end := start + count
+	if end > len(tweets) {
+		end = len(tweets)
+	}
+	return tweets[start:end], strconv.Itoa(end), nil
+}
+
+// FollowersPage returns a page of the fixture followers of a user as follows.  The page token is the index of the first follower of the page.
+func (src *fixtureSource) FollowersPage(ctx context.Context, user *models.SimpleRequest, pageToken string) ([]*models.Follow, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+	page, next, err := fixturePage(src.followers[user.UID], pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	currTime := time.Now()
+	var followers []*models.Follow
+	for _, follower := range page {
+		followers = append(followers, &models.Follow{
+			FollowerID:       follower.ID,
+			FollowerUsername: follower.Username,
+			CreatedAt:        follower.CreatedAt,
+			FolloweeID:       user.UID,
+			FolloweeUsername: user.Username,
+			CollectedAt:      currTime,
+		})
+	}
+	return followers, next, nil
+}
+
+// FollowingsPage returns a page of the fixture followings of a user as follows.  The page token is the index of the first following of the page.
+func (src *fixtureSource) FollowingsPage(ctx context.Context, user *models.SimpleRequest, pageToken string) ([]*models.Follow, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+	page, next, err := fixturePage(src.followings[user.UID], pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	currTime := time.Now()
+	var follows []*models.Follow
+	for _, followee := range page {
+		follows = append(follows, &models.Follow{
+			FollowerID:       user.UID,
+			FollowerUsername: user.Username,
+			CreatedAt:        followee.CreatedAt,
+			FolloweeID:       followee.ID,
+			FolloweeUsername: followee.Username,
+			CollectedAt:      currTime,
+		})
+	}
+	return follows, next, nil
+}
+
+// fixturePage returns the page of users starting at the index in pageToken, and the token of the next page.
+func fixturePage(users []fixtureUser, pageToken string) ([]fixtureUser, string, error) {
+	start := 0
+	if pageToken != "" {
+		var err error
+		start, err = strconv.Atoi(pageToken)
+		if err != nil || start < 0 {
+			return nil, "", fmt.Errorf("invalid fixture page token %q", pageToken)
+		}
+	}
+	if start >= len(users) {
+		return nil, "", nil
+	}
+	end := start + fixturePageSize
+	if end >= len(users) {
+		return users[start:], "", nil
+	}
+	return users[start:end], strconv.Itoa(end), nil
+}
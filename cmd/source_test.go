@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	twitterscraper "github.com/n0madic/twitter-scraper"
+)
+
+func TestFixtureFetchTweets(t *testing.T) {
+	src := newFixtureSource()
+	var tweets []*twitterscraper.Tweet
+	for i := 0; i < 5; i++ {
+		tweets = append(tweets, &twitterscraper.Tweet{ID: strconv.Itoa(i)})
+	}
+	src.AddTweets("Alice", tweets)
+
+	tests := []struct {
+		name    string
+		count   int
+		cursor  string
+		want    int
+		next    string
+		wantErr bool
+	}{
+		{name: "first page", count: 2, cursor: "", want: 2, next: "2"},
+		{name: "last page", count: 2, cursor: "4", want: 1, next: "5"},
+		{name: "past the end", count: 2, cursor: "9", want: 0, next: ""},
+		{name: "negative cursor", count: 2, cursor: "-1", wantErr: true},
+		{name: "invalid cursor", count: 2, cursor: "abc", wantErr: true},
+		{name: "no page size", count: 0, cursor: "", wantErr: true},
+		{name: "negative page size", count: -3, cursor: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, next, err := src.FetchTweets(context.Background(), "alice", tt.count, tt.cursor)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d tweets", len(page))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) != tt.want || next != tt.next {
+				t.Errorf("got %d tweets and cursor %q, want %d tweets and cursor %q", len(page), next, tt.want, tt.next)
+			}
+		})
+	}
+}
+
+func TestFixturePage(t *testing.T) {
+	users := make([]fixtureUser, fixturePageSize+1)
+
+	page, next, err := fixturePage(users, "")
+	if err != nil || len(page) != fixturePageSize || next != strconv.Itoa(fixturePageSize) {
+		t.Errorf("first page: got %d users, token %q, error %v", len(page), next, err)
+	}
+	page, next, err = fixturePage(users, next)
+	if err != nil || len(page) != 1 || next != "" {
+		t.Errorf("last page: got %d users, token %q, error %v", len(page), next, err)
+	}
+	_, _, err = fixturePage(users, "-1")
+	if err == nil {
+		t.Error("negative page token: expected an error")
+	}
+}
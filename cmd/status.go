@@ -0,0 +1,162 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+)
+
+// Worker states shown on the dashboard.
+const (
+	workerIdle    = "idle"
+	workerRunning = "running"
+	workerOff     = "off"
+	workerPaused  = "paused"
+)
+
+// workerStatus is the progress of a single worker.  Workers write to it and handlers read from it, so every field is guarded by mu.
+type workerStatus struct {
+	mu          sync.Mutex
+	label       string
+	state       string
+	item        string
+	done        int
+	total       int
+	startedAt   time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// workerSnapshot is a copy of a workerStatus taken at one point in time, safe to pass to the templates.
+// ETA is zero when it can not be estimated yet.
+type workerSnapshot struct {
+	Kind        string
+	Label       string
+	State       string
+	Item        string
+	Done        int
+	Total       int
+	StartedAt   time.Time
+	ETA         time.Duration
+	LastError   string
+	LastErrorAt time.Time
+	QueuedJobs  int
+	Paused      bool
+}
+
+// start marks the worker as running on an item.  Progress is reset.
+func (s *workerStatus) start(item string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = workerRunning
+	s.item = item
+	s.done, s.total = 0, 0
+	s.startedAt = time.Now()
+}
+
+// progress records how many of the total units of work of the current item are done.
+// total is 0 when it is not known.
+func (s *workerStatus) progress(item string, done, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.item = item
+	s.done, s.total = done, total
+}
+
+// fail records the last error of the worker.  The error stays visible until the next error.
+func (s *workerStatus) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	s.lastErrorAt = time.Now()
+}
+
+// finish marks the worker as idle once it is done with an item.
+func (s *workerStatus) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = workerIdle
+	s.item = ""
+	s.done, s.total = 0, 0
+}
+
+// pause marks the worker as paused.
+func (s *workerStatus) pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = workerPaused
+}
+
+// stop marks the worker as off.
+func (s *workerStatus) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = workerOff
+	s.item = ""
+}
+
+// snapshot returns a copy of the status.  The ETA assumes the remaining work goes at the average pace of the work done so far.
+func (s *workerStatus) snapshot() workerSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := workerSnapshot{
+		Label:       s.label,
+		State:       s.state,
+		Item:        s.item,
+		Done:        s.done,
+		Total:       s.total,
+		StartedAt:   s.startedAt,
+		LastError:   s.lastError,
+		LastErrorAt: s.lastErrorAt,
+	}
+	if s.state == workerRunning && s.done > 0 && s.total > s.done {
+		elapsed := time.Since(s.startedAt)
+		snapshot.ETA = time.Duration(float64(elapsed) / float64(s.done) * float64(s.total-s.done)).Round(time.Second)
+	}
+	return snapshot
+}
+
+// statusRegistry holds the status of every worker, keyed by the job kind it runs.  The map is never written after newStatusRegistry,
+// so it can be read from any goroutine.
+type statusRegistry struct {
+	workers map[string]*workerStatus
+}
+
+// workerLabels are the names of the workers shown on the dashboard, in the order they are shown.
+var workerLabels = []struct {
+	kind  string
+	label string
+}{
+	{models.JobProfile, "Profile Scrape"},
+	{models.JobTweets, "Tweets Scrape"},
+	{models.JobFollowers, "Follower Scrape"},
+	{models.JobFollowings, "Following Scrape"},
+	{models.JobConnections, "Connections Scrape"},
+}
+
+// newStatusRegistry creates an idle status for every worker.
+func newStatusRegistry() *statusRegistry {
+	registry := &statusRegistry{workers: make(map[string]*workerStatus)}
+	for _, worker := range workerLabels {
+		registry.workers[worker.kind] = &workerStatus{label: worker.label, state: workerIdle}
+	}
+	return registry
+}
+
+// worker returns the status of the worker that runs jobs of a kind.
+func (r *statusRegistry) worker(kind string) *workerStatus {
+	return r.workers[kind]
+}
+
+// snapshot returns a copy of the status of every worker in dashboard order.  queued is the number of queued jobs of each kind.
+func (r *statusRegistry) snapshot(queued map[string]int) []workerSnapshot {
+	var snapshots []workerSnapshot
+	for _, worker := range workerLabels {
+		snapshot := r.workers[worker.kind].snapshot()
+		snapshot.Kind = worker.kind
+		snapshot.QueuedJobs = queued[worker.kind]
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
@@ -12,12 +12,12 @@ import (
 )
 
 // Contains the data that will be passed to the templates.
+// FollowerQueueDepth and FollowingQueueDepth are the pages waiting in the follower and following queues.
 type statusData struct {
-	FollowerStatus    string
-	FollowingStatus   string
-	ProfileStatus     string
-	ConnectionsStatus string
-	NumberOfUsers     int
+	Workers             []workerSnapshot
+	FollowerQueueDepth  int
+	FollowingQueueDepth int
+	NumberOfUsers       int
 }
 
 type usersPage struct {
@@ -39,6 +39,65 @@ type userViewPage struct {
 	CurrentUser models.User
 	Schools     []models.School
 	Form        any
+	//profile history drawn from the user's snapshots
+	Charts []chartSeries
+	//how much of the user's followers and followings was collected
+	Coverage []models.FollowCoverage
+	//the user's tweets by type, and the users they retweeted and quoted
+	TweetTypes []models.TweetTypeCount
+	Retweeted  []models.TweetEdge
+	Quoted     []models.TweetEdge
+	//the user's newest tweets, each links to its thread
+	RecentTweets []models.Tweet
+	//the average sentiment and toxicity of the user's tweets
+	Scores models.ScoreAverage
+}
+
+// failedJob is a dead-letter job with the handle of the user it is about and the error of every attempt.
+type failedJob struct {
+	Job     models.Job
+	Subject string
+	Errors  []models.JobError
+}
+
+// activeJob is a running or queued job with the handle of the user it is about.
+type activeJob struct {
+	Job     models.Job
+	Subject string
+}
+
+// dashboardPage holds the worker controls, the jobs that can be cancelled and the schedules.  Workers has the same snapshots as the status partial.
+type dashboardPage struct {
+	Workers       []workerSnapshot
+	Jobs          []activeJob
+	Schedules     []models.Schedule
+	ScheduleKinds []string
+	Schools       []models.School
+	Form          any
+	Profiles      profileStats
+}
+
+type failedJobsPage struct {
+	Jobs []failedJob
+}
+
+// domainsPage holds the domains each cohort shares most.
+type domainsPage struct {
+	Cohorts []cohortDomains
+	Ignored []string
+}
+
+// scoresPage holds the average sentiment and toxicity of the tweets of each cohort and participant.
+type scoresPage struct {
+	Cohorts      []models.CohortScore
+	Participants []models.ParticipantScore
+}
+
+// threadPage is a conversation nested from its root.  TweetID is the tweet the page was opened for.
+type threadPage struct {
+	TweetID int64
+	Root    *threadNode
+	Size    int
 }
 
 type adminSignupPage struct {
@@ -57,19 +116,45 @@ type templateData struct {
 	UserViewPage    userViewPage
 	AdminSignupPage adminSignupPage
 	AdminLoginPage  adminLoginPage
+	FailedJobsPage  failedJobsPage
+	ThreadPage      threadPage
+	DomainsPage     domainsPage
+	ScoresPage      scoresPage
+	DashboardPage   dashboardPage
 	Flash           string
 	IsAdmin         bool
 	CSRFToken       string
 }
 
 var functions = template.FuncMap{
-	"currentDate": currDateFormatter,
+	"currentDate":  currDateFormatter,
+	"humanizeTime": humanizeTime,
+	"percent":      percent,
+	"signed":       signed,
 }
 
 func currDateFormatter() string {
 	return time.Now().Format("January 1 2006 at 15:04")
 }
 
+// humanizeTime formats a time for the dashboard.  The zero time is shown as an empty string.
+func humanizeTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("Jan 02 15:04:05")
+}
+
+// percent formats a ratio between 0 and 1 as a whole percentage.
+func percent(ratio float64) string {
+	return fmt.Sprintf("%.0f%%", ratio*100)
+}
+
+// signed formats a score from -1 to 1 with its sign and two decimals.
+func signed(score float64) string {
+	return fmt.Sprintf("%+.2f", score)
+}
+
 // newTemplateCache is a helper function that loads all HTML templates into a template cache, and returns a map of template names to template.
 // This will make it easy to render templates in the future, since the templates will be in the cache already and you will not have to parse them for every request.
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -132,13 +217,22 @@ func (app *application) renderTemplate(w http.ResponseWriter, status int, page s
 
 }
 
-// populateWorkerStatus is a helper function that populates the FollowerStatus and FollowingStatus fields of the templateData struct.
+// populateStatusData is a helper function that populates the StatusData field of the templateData struct with a snapshot of every worker.
 func (app *application) populateStatusData(data *templateData) {
+	queued, err := models.CountQueuedJobs(app.connection)
+	if err != nil {
+		app.errorLog.Println("Error counting queued jobs:", err)
+	}
+
+	workers := app.status.snapshot(queued)
+	for i := range workers {
+		workers[i].Paused = app.control.isPaused(workers[i].Kind)
+	}
+
 	data.StatusData = statusData{
-		FollowerStatus:    app.followStatus,
-		FollowingStatus:   app.followingStatus,
-		ProfileStatus:     app.profileStatus,
-		ConnectionsStatus: app.connectionsStatus,
+		Workers:             workers,
+		FollowerQueueDepth:  len(app.followerQueue),
+		FollowingQueueDepth: len(app.followQueue),
 	}
 
 	data.StatusData.NumberOfUsers, _ = models.GetUserCount(app.connection)
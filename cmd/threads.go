@@ -0,0 +1,32 @@
+package main
+
+import "github.com/rainbowriverrr/F3Ytwitter/internal/models"
+
+// recentTweetsShown is how many of a user's newest tweets the user page links to threads.
+const recentTweetsShown = 20
+
+// threadNode is a tweet of a conversation with the replies to it, for the thread page.  Selected marks the tweet the page was opened for.
+type threadNode struct {
+	Tweet    models.ThreadTweet
+	Selected bool
+	Replies  []*threadNode
+}
+
+// buildThread nests the tweets of a conversation under the tweets they reply to.  The tweets must come parent first, as GetConversation returns them.
+// Returns the root of the conversation.
+func buildThread(tweets []models.ThreadTweet, selected int64) *threadNode {
+	var root *threadNode
+	nodes := make(map[int64]*threadNode, len(tweets))
+	for _, tweet := range tweets {
+		node := &threadNode{Tweet: tweet, Selected: tweet.ID == selected}
+		nodes[tweet.ID] = node
+		if tweet.ParentID == nil {
+			root = node
+			continue
+		}
+		if parent, ok := nodes[*tweet.ParentID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+	return root
+}
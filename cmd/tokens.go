@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitWindow is how long a token is benched after a 429 that did not say when the limit resets.
+const defaultRateLimitWindow = 15 * time.Minute
+
+// tokenParkWindow is how long a token is left unused after twitter refused it with a bare 401 or 403.
+const tokenParkWindow = 15 * time.Minute
+
+// rateLimit is the budget of a bearer token on one endpoint, as last reported by twitter.
+// remaining is -1 until twitter has reported it.
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+}
+
+// bearerToken is a single v2 api token and its budget on every endpoint it has been used on.
+type bearerToken struct {
+	value  string
+	limits map[string]*rateLimit
+	//the token is not used on any endpoint until then
+	parkedUntil time.Time
+}
+
+// tokenPool schedules v2 api requests onto whichever bearer token still has budget for an endpoint.
+// Budgets come from the x-rate-limit headers of previous responses, so requests only wait as long as twitter requires.
+type tokenPool struct {
+	mu     sync.Mutex
+	tokens []*bearerToken
+	//index of the token the next search starts at, so tokens are used round robin
+	next int
+}
+
+// newTokenPool creates a tokenPool from a list of bearer tokens.  Empty and duplicate tokens are skipped.
+func newTokenPool(values []string) *tokenPool {
+	pool := &tokenPool{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		pool.tokens = append(pool.tokens, &bearerToken{
+			value:  value,
+			limits: make(map[string]*rateLimit),
+		})
+	}
+	return pool
+}
+
+// size returns the number of tokens in the pool.
+func (p *tokenPool) size() int {
+	return len(p.tokens)
+}
+
+// limit returns the budget of a token on an endpoint.  p.mu must be held.
+func (t *bearerToken) limit(endpoint string) *rateLimit {
+	limit, ok := t.limits[endpoint]
+	if !ok {
+		limit = &rateLimit{remaining: -1}
+		t.limits[endpoint] = limit
+	}
+	return limit
+}
+
+// tryAcquire returns a token with budget left on the endpoint and reserves one request of its budget.
+// If every token is exhausted, it returns nil and the earliest time a budget resets.
+func (p *tokenPool) tryAcquire(endpoint string, now time.Time) (*bearerToken, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var earliest time.Time
+	for i := 0; i < len(p.tokens); i++ {
+		token := p.tokens[(p.next+i)%len(p.tokens)]
+		if now.Before(token.parkedUntil) {
+			if earliest.IsZero() || token.parkedUntil.Before(earliest) {
+				earliest = token.parkedUntil
+			}
+			continue
+		}
+		limit := token.limit(endpoint)
+		//a budget that has passed its reset time is full again, but the real size is unknown until the next response
+		if limit.remaining == 0 && !now.Before(limit.reset) {
+			limit.remaining = -1
+		}
+		if limit.remaining != 0 {
+			if limit.remaining > 0 {
+				limit.remaining--
+			}
+			p.next = (p.next + i + 1) % len(p.tokens)
+			return token, time.Time{}
+		}
+		if earliest.IsZero() || limit.reset.Before(earliest) {
+			earliest = limit.reset
+		}
+	}
+	return nil, earliest
+}
+
+// acquire returns a token with budget left on the endpoint.  If every token is exhausted, it waits until the earliest reset,
+// or returns ctx.Err() if ctx is cancelled first.
+func (p *tokenPool) acquire(ctx context.Context, endpoint string) (*bearerToken, error) {
+	for {
+		token, reset := p.tryAcquire(endpoint, time.Now())
+		if token != nil {
+			return token, nil
+		}
+
+		timer := time.NewTimer(time.Until(reset))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// update records the rate limit headers of a response to a request made with token.
+// A 429 always exhausts the token, even if the headers are missing.
+func (p *tokenPool) update(token *bearerToken, endpoint string, resp *http.Response) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limit := token.limit(endpoint)
+	remaining, err := strconv.Atoi(resp.Header.Get("x-rate-limit-remaining"))
+	if err == nil {
+		limit.remaining = remaining
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64)
+	if err == nil {
+		limit.reset = time.Unix(reset, 0)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		limit.remaining = 0
+		if !limit.reset.After(time.Now()) {
+			limit.reset = time.Now().Add(defaultRateLimitWindow)
+		}
+	}
+}
+
+// park stops token from being used on any endpoint until the given time.
+func (p *tokenPool) park(token *bearerToken, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token.parkedUntil = until
+}
+
+// bearerTokensFromEnv collects bearer tokens from the comma separated BEARER_TOKENS variable,
+// and from BEARER_TOKEN and BEARER_TOKEN2 for older .env files.
+func bearerTokensFromEnv(getenv func(string) string) []string {
+	tokens := strings.Split(getenv("BEARER_TOKENS"), ",")
+	return append(tokens, getenv("BEARER_TOKEN"), getenv("BEARER_TOKEN2"))
+}
@@ -1,513 +1,806 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	twitterscraper "github.com/n0madic/twitter-scraper"
 	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
 )
 
 // ProfileWorker is the worker that scrapes the twitter profile of a user and stores it in the database concurrently.
-// Then sends the user id to the follower or following channel if it falls below the limit
-func (app *application) ProfileWorker() {
-	//reads from the profile channel until it is closed
-	for curr := range app.profileChan {
-		currTime := time.Now()
-		app.profileStatus = fmt.Sprintf("scraping %s", curr.Username)
-		//always scrapes user because there will be updates
-		user, err := app.scrapeUser(curr.Username)
-		//checks if user is a participant.  If they are, it adds the relation with the school if it doesn't exist already
-		if curr.IsParticipant {
-			//add logic to create relation with school if it doesn't exist
-			user.IsParticipant = true
-		} else {
-			user.IsParticipant = false
-		}
+// Then queues followers and followings jobs for the user if they fall below the limit
+func (app *application) ProfileWorker(ctx context.Context) {
+	//leases profile jobs until ctx is cancelled
+	app.runJobs(ctx, models.JobProfile, app.profileJob)
+	app.infoLog.Println("Profile Worker finished")
+}
 
+// profileJob handles a single profile job.  The payload is a simplifiedUser.
+func (app *application) profileJob(ctx context.Context, job *models.Job) error {
+	var curr simplifiedUser
+	err := json.Unmarshal(job.Payload, &curr)
+	if err != nil {
+		return err
+	}
+
+	currTime := time.Now()
+
+	//always scrapes user because there will be updates
+	user, err := app.scrapeUser(ctx, curr.Username)
+	if err != nil {
+		return fmt.Errorf("error scraping user: %w", err)
+	}
+	//checks if user is a participant.  If they are, it adds the relation with the school if it doesn't exist already
+	user.IsParticipant = curr.IsParticipant
+
+	//checks if the user is already in the database, if not, it adds it.  Checked by ID, since the handle may have belonged to someone else before
+	if models.UserIDExists(app.connection, user.ID) {
+		app.infoLog.Println("User already exists in database")
+		app.infoLog.Println("Updating user in database")
+		err = models.UpdateUser(app.connection, user)
 		if err != nil {
-			app.errorLog.Println("Error scraping user:", err)
-			continue
+			return fmt.Errorf("error updating user in database: %w", err)
 		}
-		//checks if the user is already in the database, if not, it adds it.
-		if models.UserExists(app.connection, user.Handle) {
-			app.infoLog.Println("User already exists in database")
-			app.infoLog.Println("Updating user in database")
-			err = models.UpdateUser(app.connection, user)
-			if err != nil {
-				app.errorLog.Println("Error updating user in database")
-				app.errorLog.Println(err)
-				app.profileStatus = "idle"
-				continue
+	} else {
+		app.infoLog.Println("User not in database")
+		app.infoLog.Println("Adding user to database")
+		err = models.InsertUser(app.connection, user)
+		if err != nil {
+			return fmt.Errorf("error adding user to database: %w", err)
+		}
+	}
+
+	//checks if user is participant, and adds them to the students table if they are
+	if curr.IsParticipant {
+		//checks if student exists, adds them to the database if they don't
+		inserted := !models.StudentExists(app.connection, user.ID)
+		if inserted {
+			student := &models.Student{
+				UserID:   user.ID,
+				SchoolID: curr.ParticipantSchoolID,
+				Cohort:   curr.ParticipantCohort,
+				Limits:   curr.Limits,
 			}
-		} else {
-			app.infoLog.Println("User not in database")
-			app.infoLog.Println("Adding user to database")
-			err = models.InsertUser(app.connection, user)
+			if !curr.StartDate.IsZero() {
+				student.StartDate = &curr.StartDate
+			}
+			if !curr.EndDate.IsZero() {
+				student.EndDate = &curr.EndDate
+			}
+			err = models.InsertStudent(app.connection, student)
 			if err != nil {
-				app.errorLog.Println("Error adding user to database")
-				app.errorLog.Println(err)
-				app.profileStatus = "idle"
-				continue
+				return fmt.Errorf("error adding student to database: %w", err)
 			}
-		}
-
-		//checks if user is participant, and adds them to the students table if they are
-		if curr.IsParticipant {
-			//checks if student exists, adds them to the database if they don't
-			if !models.StudentExists(app.connection, user.ID) {
-				student := &models.Student{
-					UserID:   user.ID,
-					SchoolID: curr.ParticipantSchoolID,
-					Cohort:   curr.ParticipantCohort,
-				}
-				err = models.InsertStudent(app.connection, student)
-				if err != nil {
-					app.errorLog.Println("Error adding student to database")
-					app.errorLog.Println(err)
-					app.profileStatus = "idle"
-					continue
-				}
+		} else if !curr.StartDate.IsZero() {
+			//keeps the study window up to date so scheduled tweets jobs collect the right dates
+			var endDate *time.Time
+			if !curr.EndDate.IsZero() {
+				endDate = &curr.EndDate
 			}
-		}
-
-		//checks if the user is a school.  If they are, it adds them to the school database including user database.
-		if curr.IsSchool {
-			app.infoLog.Println("User is a school")
-			err = app.addSchool(curr.SchoolInfo)
+			err = models.UpdateStudentDates(app.connection, user.ID, curr.StartDate, endDate)
 			if err != nil {
-				app.errorLog.Println("Error adding school to database")
-				app.errorLog.Println(err)
-				app.profileStatus = "idle"
-				continue
+				return fmt.Errorf("error updating student dates: %w", err)
 			}
 		}
-
-		//adds biotags to the database
-		tags := getBioTags(user.Bio)
-		for _, tag := range tags {
-			//checks if the tagged user is already in the database, if not, it adds it.
-			if !models.UserExists(app.connection, tag) {
-				taggedUser, err := app.scrapeUser(tag)
-				if err != nil {
-					app.errorLog.Println("Error scraping tagged user:", err)
-					continue
-				}
-				err = models.InsertUser(app.connection, taggedUser)
-				if err != nil {
-					app.errorLog.Println("Error adding tagged user to database")
-					app.errorLog.Println(err)
-					continue
-				}
-
-				toAdd := &models.BioTag{
-					UserID:          user.ID,
-					MentionedUserID: taggedUser.ID,
-					CollectedAt:     &currTime,
-				}
-
-				app.addBioTag(toAdd)
-			} else {
-				taggedUserID, err := models.GetUserIDByHandle(app.connection, tag)
-				if err != nil {
-					app.errorLog.Println("Error getting tagged user id:", err)
-					continue
-				}
-				toAdd := &models.BioTag{
-					UserID:          user.ID,
-					MentionedUserID: taggedUserID,
-					CollectedAt:     &currTime,
-				}
-
-				app.addBioTag(toAdd)
+		//limits given with the request replace the participant's limits, whether or not it changes their dates
+		if !inserted && !curr.Limits.Empty() {
+			err = models.SetStudentFollowLimits(app.connection, user.ID, curr.Limits)
+			if err != nil {
+				return fmt.Errorf("error updating student follow limits: %w", err)
 			}
 		}
+	}
 
-		//adds uid to simplifiedUser struct
-		curr.ID = user.ID
-		//Sends the simplifiedUser struct to the tweets channel.
-		if curr.IsParticipant && curr.ScrapeContent {
-			app.tweetsChan <- curr
+	//checks if the user is a school.  If they are, it adds them to the school database including user database.
+	if curr.IsSchool {
+		app.infoLog.Println("User is a school")
+		err = app.addSchool(ctx, curr.SchoolInfo)
+		if err != nil {
+			return fmt.Errorf("error adding school to database: %w", err)
 		}
+	}
 
-		//convert simplifiedUser to SimpleRequest
-		simpleFollowRequest := simpleUsertoSimpleRequest(curr)
-		simpleFollowerRequest := simpleUsertoSimpleRequest(curr)
-
-		//checks if user followers exceeds limit, if so, it does not scrape the followers
-		if user.Followers > app.followLimit {
-			app.infoLog.Println("User has too many followers, not scraping followers")
-			app.profileStatus = "idle"
-		} else if curr.ScrapeConnections {
-			app.infoLog.Printf("Sending %s to followers channel and backup channel", user.Handle)
-			simpleFollowerRequest.ID, err = models.InsertSimpleRequest(app.connection, simpleFollowerRequest, "follower_requests")
+	//adds biotags to the database, all at once after every tagged user is known
+	tags := getBioTags(user.Bio)
+	var bioTags []*models.BioTag
+	for _, tag := range tags {
+		//checks if the tagged user is already in the database, if not, it adds it.
+		if !models.UserExists(app.connection, tag) {
+			taggedUser, err := app.lookupUser(ctx, tag)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				app.errorLog.Println("Error scraping tagged user:", err)
+				continue
+			}
+			err = models.InsertUser(app.connection, taggedUser)
 			if err != nil {
-				app.errorLog.Println("Error backing up simple request")
+				app.errorLog.Println("Error adding tagged user to database")
 				app.errorLog.Println(err)
+				continue
 			}
-			app.followerChan <- simpleFollowerRequest
-		}
 
-		//checks if user following exceeds limit, if so, it does not scrape the following
-		if user.Following > app.followLimit {
-			app.infoLog.Println("User has too many following, not scraping following")
-			app.profileStatus = "idle"
-		} else if curr.ScrapeConnections {
-			app.infoLog.Printf("Sending %s to following channel", user.Handle)
-			simpleFollowRequest.ID, err = models.InsertSimpleRequest(app.connection, simpleFollowRequest, "follow_requests")
+			bioTags = append(bioTags, &models.BioTag{
+				UserID:          user.ID,
+				MentionedUserID: taggedUser.ID,
+				CollectedAt:     &currTime,
+			})
+		} else {
+			taggedUserID, err := models.GetUserIDByHandle(app.connection, tag)
 			if err != nil {
-				app.errorLog.Println("Error backing up simple request")
-				app.errorLog.Println(err)
+				app.errorLog.Println("Error getting tagged user id:", err)
+				continue
 			}
-			app.followChan <- simpleFollowRequest
+			bioTags = append(bioTags, &models.BioTag{
+				UserID:          user.ID,
+				MentionedUserID: taggedUserID,
+				CollectedAt:     &currTime,
+			})
 		}
-
-		app.profileStatus = "idle"
-
 	}
-	app.profileStatus = "off"
-	app.infoLog.Println("Profile Worker finished")
-}
+	app.addBioTags(bioTags)
 
-// TweetsWorker is the worker that scrapes the tweets of a user and stores them in the database concurrently
-func (app *application) TweetsWorker() {
-	//reads from the tweets channel until it is closed
-	for user := range app.tweetsChan {
-		app.tweetsStatus = fmt.Sprintf("scraping %s", user.Username)
-		//scrapes tweets and updates them in database (includes retweets and replies)
-		app.infoLog.Println("Scraping tweets for user:", user.ID)
-		tweets := app.scrapeTweets(user.Username, user.StartDate)
-		err := app.updateTweets(tweets)
+	//adds uid to simplifiedUser struct
+	curr.ID = user.ID
+	//Queues the tweets of the participant
+	if curr.IsParticipant && curr.ScrapeContent {
+		_, err = app.enqueueJob(models.JobTweets, curr.ID, curr)
 		if err != nil {
-			app.errorLog.Println("Error scraping tweets:", err)
-			continue
-		}
-		//scrapes mentions and updates them in database
-		app.infoLog.Println("Scraping mentions for user:", user.ID)
-		userSlice, mentionsSlice := app.scrapeMentions(tweets)
-		//double checks if the user is already in the database, if not, it adds it.
-		for _, user := range userSlice {
-			if !models.UserExists(app.connection, user.Handle) {
-				err = models.InsertUser(app.connection, user)
-				if err != nil {
-					app.errorLog.Println("Error adding user to database")
-					app.errorLog.Println(err)
-					continue
-				}
-			}
+			return fmt.Errorf("error queueing tweets job: %w", err)
 		}
-		//double checks if the mention is already in the database, if not, it adds it.
-		for _, mention := range mentionsSlice {
-			if !models.MentionExists(app.connection, mention) {
-				err = models.InsertMention(app.connection, mention)
-				if err != nil {
-					app.errorLog.Println("Error adding mention to database")
-					app.errorLog.Println(err)
-					continue
-				}
-			}
-		}
-		app.tweetsStatus = "idle"
 	}
-	app.tweetsStatus = "off"
-	app.infoLog.Println("Tweets Worker finished")
-}
-
-// Follow Worker is the worker that scrapes the followings of a user and stores them in the database concurrently.
-func (app *application) FollowWorker() {
-	//reads from the follow channel until it is closed
-	for user := range app.followChan {
-		app.followingStatus = fmt.Sprintf("scraping %s", user.Username)
 
-		//check number of follows
-		ucheck, err := models.GetUserByID(app.connection, user.UID)
+	//checks if user followers exceeds limit, if so, it does not scrape the followers unless over limit lists are sampled
+	limits := app.followLimitsFor(user.ID)
+	if overLimit(user.Followers, limits.followers) && !app.sampleOverLimit {
+		app.infoLog.Println("User has too many followers, not scraping followers")
+	} else if curr.ScrapeConnections {
+		app.infoLog.Printf("Queueing followers job for %s", user.Handle)
+		_, err = app.enqueueJob(models.JobFollowers, curr.ID, simpleUsertoSimpleRequest(&curr))
 		if err != nil {
-			app.errorLog.Println("Error getting user by id:", err)
-			continue
+			return fmt.Errorf("error queueing followers job: %w", err)
 		}
-		if ucheck.Following > app.followLimit {
-			app.infoLog.Println("User has too many following, not scraping following")
-			app.followingStatus = "idle"
-			continue
+	}
+
+	//checks if user following exceeds limit, if so, it does not scrape the following unless over limit lists are sampled
+	if overLimit(user.Following, limits.followings) && !app.sampleOverLimit {
+		app.infoLog.Println("User has too many following, not scraping following")
+	} else if curr.ScrapeConnections {
+		app.infoLog.Printf("Queueing followings job for %s", user.Handle)
+		_, err = app.enqueueJob(models.JobFollowings, curr.ID, simpleUsertoSimpleRequest(&curr))
+		if err != nil {
+			return fmt.Errorf("error queueing followings job: %w", err)
 		}
+	}
 
-		app.infoLog.Println("Scraping followings for user:", user.UID)
+	return nil
+}
 
-		upstreamChan := make(chan []*models.Follow)
+// TweetsWorker is the worker that scrapes the tweets of a user and stores them in the database concurrently
+func (app *application) TweetsWorker(ctx context.Context) {
+	//leases tweets jobs until ctx is cancelled
+	app.runJobs(ctx, models.JobTweets, app.tweetsJob)
+	app.infoLog.Println("Tweets Worker finished")
+}
 
-		request := &followRequest{
-			User:     user,
-			upstream: upstreamChan,
-		}
-		//sends request for follows to the follow queue channel
-		app.infoLog.Println("Sending request for follows for user:", user.UID)
-		app.followQueue <- request
-		// //waits for the response from the follow queue channel
-		app.infoLog.Printf("Waiting for follow response for user: %s", user.Username)
-		follows := <-upstreamChan
-		close(upstreamChan)
-		if follows == nil {
-			app.errorLog.Println("No follows found for user:", user.Username)
-			continue
-		}
+// tweetsCheckpoint is the progress of a tweets job.  From is the lower bound the job started with, it is kept so a retried job
+// still pages back to it.  StartedAt is when the job first started, the timeline is complete up to then once the job reaches From.
+type tweetsCheckpoint struct {
+	Cursor    string    `json:"cursor"`
+	Pages     int       `json:"pages"`
+	Collected int       `json:"collected"`
+	From      time.Time `json:"from"`
+	StartedAt time.Time `json:"started_at"`
+}
 
-		app.infoLog.Printf("%d follows recieved for user: %s", len(follows), user.Username)
+// tweetsJob handles a single tweets job.  The payload is a simplifiedUser.
+// Every page of the timeline is stored as soon as it arrives and the cursor of the next page is checkpointed, so a failed or interrupted job resumes at the last good page.
+// Only once the job pages back to its lower bound is the timeline of the user recorded as collected, so a failed job never leaves a gap.
+func (app *application) tweetsJob(ctx context.Context, job *models.Job) error {
+	var user simplifiedUser
+	err := json.Unmarshal(job.Payload, &user)
+	if err != nil {
+		return err
+	}
 
-		err = app.updateFollows(follows)
+	var checkpoint tweetsCheckpoint
+	err = loadCheckpoint(job, &checkpoint)
+	if err != nil {
+		return err
+	}
+
+	if checkpoint.StartedAt.IsZero() {
+		checkpoint.StartedAt = time.Now().UTC()
+		//only pages back to where the timeline was last collected, minus the overlap window so engagement of recent tweets is updated
+		checkpoint.From = user.StartDate
+		until, err := models.GetTweetsCollectedUntil(app.connection, user.ID)
 		if err != nil {
-			app.errorLog.Println("Error updating followings:", err)
-			continue
+			return fmt.Errorf("error getting tweets collected until: %w", err)
 		}
-
-		//removes backup request from database
-		models.DeleteSimpleRequest(app.connection, user, "follow_requests")
-
-		connectionRequestBackup := &models.ConnectionRequest{
-			UID:                user.UID,
-			Username:           user.Username,
-			FollowsOrFollowers: "follows",
+		if until != nil && until.Add(-app.tweetOverlap).After(checkpoint.From) {
+			checkpoint.From = until.Add(-app.tweetOverlap)
 		}
-
-		BackupID, err := models.InsertConnectionRequest(app.connection, connectionRequestBackup)
-		app.infoLog.Println("Backing up connection request with BackupID:", BackupID)
+		err = app.saveCheckpoint(job, &checkpoint)
 		if err != nil {
-			app.errorLog.Println("Error backing up connection request:", err)
+			return err
 		}
+	}
 
-		// app.infoLog.Printf("FOLLOW WORKER: Printing all Follows for user: %s\n", user.Username)
-		// for _, follow := range follows {
-		// 	app.infoLog.Printf("Follower: %s, Followee: %s\n", follow.FollowerUsername, follow.FolloweeUsername)
-		// }
+	if checkpoint.Pages > 0 {
+		app.infoLog.Printf("Resuming tweets of %s after page %d", user.Username, checkpoint.Pages)
+	} else {
+		app.infoLog.Printf("Collecting tweets of %s since %s", user.Username, checkpoint.From.Format(time.RFC3339))
+	}
 
-		app.infoLog.Println("Sending request to connections worker for user:", user.Username)
-		app.connectionsChan <- connectionsRequest{
-			ID:      BackupID,
-			follows: follows,
-			users:   "followings",
+	//scrapes tweets and updates them in database (includes retweets and replies)
+	err = app.collectTweets(ctx, user.Username, checkpoint.Cursor, checkpoint.From, user.EndDate, func(tweets []*twitterscraper.Tweet, next string) error {
+		err := app.updateTweets(ctx, tweets)
+		if err != nil {
+			return err
 		}
 
-		app.followStatus = "idle"
+		checkpoint.Cursor = next
+		checkpoint.Pages++
+		checkpoint.Collected += len(tweets)
+		return app.saveCheckpoint(job, &checkpoint)
+	})
+	if err != nil {
+		return fmt.Errorf("error collecting tweets of %s: %w", user.Username, err)
+	}
+	app.infoLog.Printf("%d tweets collected from %s", checkpoint.Collected, user.Username)
+
+	err = models.SetTweetsCollectedUntil(app.connection, user.ID, checkpoint.StartedAt)
+	if err != nil {
+		return fmt.Errorf("error setting tweets collected until: %w", err)
 	}
+	return nil
+}
 
-	app.followingStatus = "off"
+// Follow Worker is the worker that scrapes the followings of a user and stores them in the database concurrently.
+func (app *application) FollowWorker(ctx context.Context) {
+	//leases followings jobs until ctx is cancelled
+	app.runJobs(ctx, models.JobFollowings, app.followingsJob)
 	app.infoLog.Println("Followings Worker finished")
 }
 
+// followingsJob handles a single followings job.  The payload is a models.SimpleRequest.
+func (app *application) followingsJob(ctx context.Context, job *models.Job) error {
+	return app.followJob(ctx, job, "followings")
+}
+
 // Follower Worker is the worker that scrapes the followers of a user and stores them in the database concurrently.
-func (app *application) FollowerWorker() {
-	//reads from the follower channel until it is closed
-	for user := range app.followerChan {
-		app.followStatus = fmt.Sprintf("scraping %s", user.Username)
+func (app *application) FollowerWorker(ctx context.Context) {
+	//leases followers jobs until ctx is cancelled
+	app.runJobs(ctx, models.JobFollowers, app.followersJob)
+	app.infoLog.Println("Follower Worker finished")
+}
 
-		//check number of follows
-		ucheck, err := models.GetUserByID(app.connection, user.UID)
-		if err != nil {
-			app.errorLog.Println("Error getting user by id:", err)
-			continue
-		}
-		if ucheck.Followers > app.followLimit {
-			app.infoLog.Println("User has too many followers, not scraping followers")
-			app.followingStatus = "idle"
-			continue
-		}
+// followersJob handles a single followers job.  The payload is a models.SimpleRequest.
+func (app *application) followersJob(ctx context.Context, job *models.Job) error {
+	return app.followJob(ctx, job, "followers")
+}
 
-		app.infoLog.Println("Scraping followers for user:", user.UID)
+// followCheckpoint is the progress of a followers or followings job.  SnapshotAt is when the job first started collecting,
+// every follow seen by the job is marked as seen at that time.
+type followCheckpoint struct {
+	PageToken  string    `json:"page_token"`
+	Pages      int       `json:"pages"`
+	Collected  int       `json:"collected"`
+	SnapshotAt time.Time `json:"snapshot_at"`
+}
 
-		upstreamChan := make(chan []*models.Follow)
+// followJob scrapes the followers or followings of a user, depending on direction ("followers" or "followings").
+// Every page is stored as soon as it arrives and the next page token is checkpointed, so a failed or interrupted job resumes at the last good page.
+// When the whole list is stored, the follows of the user that were not in it are ended and a connections job is queued for the user.
+// New follows are only recorded as gained when an earlier complete list exists to compare against.
+// A list over the follow limit is skipped, or with sampleOverLimit only its first samplePages pages are stored, flagged as partial.
+// How much of the list was stored is recorded as the coverage of the user in that direction.
+func (app *application) followJob(ctx context.Context, job *models.Job, direction string) error {
+	var user models.SimpleRequest
+	err := json.Unmarshal(job.Payload, &user)
+	if err != nil {
+		return err
+	}
 
-		request := &followRequest{
-			User:     user,
-			upstream: upstreamChan,
-		}
+	var checkpoint followCheckpoint
+	err = loadCheckpoint(job, &checkpoint)
+	if err != nil {
+		return err
+	}
 
-		//sends request for followers to the follower queue
-		app.infoLog.Println("Sending request for follows for user:", user.UID)
-		app.followerQueue <- request
-		//waits for the response from the follower queue
-		app.infoLog.Printf("Waiting for follower response for user: %s", user.Username)
-		followers := <-upstreamChan
-		close(upstreamChan)
-		if followers == nil {
-			app.errorLog.Println("No followers found for user:", user.Username)
-			continue
+	//check number of follows
+	ucheck, err := models.GetUserByID(app.connection, user.UID)
+	if err != nil {
+		return fmt.Errorf("error getting user by id: %w", err)
+	}
+	limits := app.followLimitsFor(user.UID)
+	count, limit, queue := ucheck.Following, limits.followings, app.followQueue
+	if direction == "followers" {
+		count, limit, queue = ucheck.Followers, limits.followers, app.followerQueue
+	}
+	//the lists of accounts around a participant are held to the connection limit
+	if user.Hop > 0 {
+		limit = limits.connections
+	}
+	sampling := overLimit(count, limit)
+	if sampling && !app.sampleOverLimit {
+		app.infoLog.Printf("User has too many %s, not scraping %s", direction, direction)
+		return nil
+	}
+	if !models.AccountCollectable(ucheck.AccountState) {
+		app.infoLog.Printf("User %s is %s, not scraping %s", user.Username, ucheck.AccountState, direction)
+		return nil
+	}
+
+	if checkpoint.SnapshotAt.IsZero() {
+		checkpoint.SnapshotAt = time.Now().UTC()
+	}
+	recordNew := models.FollowSnapshotExists(app.connection, user.UID, direction)
+
+	if checkpoint.Pages > 0 {
+		app.infoLog.Printf("Resuming %s of user %s after page %d", direction, user.Username, checkpoint.Pages)
+	} else if sampling {
+		app.infoLog.Printf("User has too many %s, sampling %d pages of %s for user: %d", direction, app.samplePages, direction, user.UID)
+	} else {
+		app.infoLog.Printf("Scraping %s for user: %d", direction, user.UID)
+	}
+
+	//a sample that already has all of its pages is not collected again on resume
+	if !sampling || checkpoint.Pages < app.samplePages {
+		err = app.collectFollows(ctx, job, queue, &user, checkpoint.PageToken, func(follows []*models.Follow, next string) error {
+			for _, follow := range follows {
+				follow.Partial = sampling
+			}
+			err := app.updateFollows(ctx, follows, checkpoint.SnapshotAt, recordNew)
+			if err != nil {
+				return fmt.Errorf("error updating %s: %w", direction, err)
+			}
+			checkpoint.PageToken = next
+			checkpoint.Pages++
+			checkpoint.Collected += len(follows)
+			app.status.worker(job.Kind).progress(user.Username, checkpoint.Collected, count)
+			err = app.saveCheckpoint(job, &checkpoint)
+			if err == nil && sampling && checkpoint.Pages >= app.samplePages {
+				return errEnoughPages
+			}
+			return err
+		})
+	}
+	if state, ok := accountStateOf(err); ok {
+		//the list can not be completed, so nothing is ended and no connections are scraped
+		app.updateAccountState(user.UID, user.Username, state)
+		app.infoLog.Printf("User %s is %s, stopped scraping %s", user.Username, state, direction)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting %s for %s: %w", direction, user.Username, err)
+	}
+
+	app.infoLog.Printf("%d %s recieved for user: %s", checkpoint.Collected, direction, user.Username)
+
+	//a sample stops with pages left, the list is only complete when the last page was reached
+	partial := checkpoint.PageToken != ""
+	err = models.UpsertFollowCoverage(app.connection, &models.FollowCoverage{
+		UserID:    user.UID,
+		Direction: direction,
+		Collected: checkpoint.Collected,
+		Expected:  count,
+		Partial:   partial,
+	})
+	if err != nil {
+		return fmt.Errorf("error recording %s coverage: %w", direction, err)
+	}
+
+	if !partial {
+		//the list is complete, so every follow of the user that was not seen in it has ended
+		ended, err := models.EndMissingFollows(app.connection, user.UID, direction, checkpoint.SnapshotAt)
+		if err != nil {
+			return fmt.Errorf("error ending missing %s: %w", direction, err)
 		}
-		app.infoLog.Printf("%d followers recieved for user: %s", len(followers), user.Username)
-		err = app.updateFollows(followers)
+		if ended > 0 {
+			app.infoLog.Printf("%d %s of user %s have ended", ended, direction, user.Username)
+		}
+		err = models.InsertFollowSnapshot(app.connection, user.UID, direction, checkpoint.SnapshotAt, checkpoint.Collected)
 		if err != nil {
-			app.errorLog.Println("Error updating followers:", err)
-			continue
+			return fmt.Errorf("error recording %s snapshot: %w", direction, err)
 		}
+	}
+
+	if !app.expansion.expands(user.Hop + 1) {
+		return nil
+	}
+	followsOrFollowers := "follows"
+	if direction == "followers" {
+		followsOrFollowers = "followers"
+	}
+	app.infoLog.Println("Queueing connections job for user:", user.Username)
+	_, err = app.enqueueJob(models.JobConnections, user.UID, &models.ConnectionRequest{
+		UID:                user.UID,
+		Username:           user.Username,
+		FollowsOrFollowers: followsOrFollowers,
+		Hop:                user.Hop,
+	})
+	if err != nil {
+		return fmt.Errorf("error queueing connections job: %w", err)
+	}
 
-		//removes backup request from database
-		models.DeleteSimpleRequest(app.connection, user, "follower_requests")
+	return nil
+}
 
-		connectionRequestBackup := &models.ConnectionRequest{
-			UID:                user.UID,
-			Username:           user.Username,
-			FollowsOrFollowers: "followers",
+// errEnoughPages is returned by the onPage function of collectFollows to stop paging before the last page.
+var errEnoughPages = errors.New("enough pages collected")
+
+// collectFollows pages through the followers or followings of a user with the given follow queue, starting at pageToken.
+// Every page is passed to onPage together with the token of the following page as soon as it arrives.
+// Paging stops without an error when onPage returns errEnoughPages.
+func (app *application) collectFollows(ctx context.Context, job *models.Job, queue chan *followRequest, user *models.SimpleRequest, pageToken string, onPage func(follows []*models.Follow, next string) error) error {
+	for {
+		//buffered so the queue never blocks on a request that was abandoned on shutdown
+		upstream := make(chan followResult, 1)
+		select {
+		case queue <- &followRequest{
+			ctx:       ctx,
+			kind:      job.Kind,
+			User:      user,
+			PageToken: pageToken,
+			upstream:  upstream,
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		var result followResult
+		select {
+		case result = <-upstream:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if result.err != nil {
+			return result.err
+		}
+
+		err := onPage(result.follows, result.next)
+		if errors.Is(err, errEnoughPages) {
+			return nil
 		}
-
-		BackupID, err := models.InsertConnectionRequest(app.connection, connectionRequestBackup)
 		if err != nil {
-			app.errorLog.Println("Error inserting connection request backup:", err)
+			return err
 		}
-
-		app.infoLog.Println("Sending request to connections worker for user:", user.Username)
-		app.connectionsChan <- connectionsRequest{
-			ID:      BackupID,
-			follows: followers,
-			users:   "followers",
+		if result.next == "" {
+			return nil
 		}
-
-		app.followStatus = "idle"
+		pageToken = result.next
 	}
-	//add connection scrape
-	app.followStatus = "off"
-	app.infoLog.Println("Follower Worker finished")
 }
 
 // Connections Worker is the worker that scrapes connections.  It acts as a queue for both the Follower Worker and Following worker in order to avoid rate limiting
-func (app *application) ConnectionsWorker() {
+func (app *application) ConnectionsWorker(ctx context.Context) {
+	//leases connections jobs until ctx is cancelled
+	app.runJobs(ctx, models.JobConnections, app.connectionsJob)
+	app.infoLog.Println("Connections Worker finished")
+}
+
+// connectionsCheckpoint is the progress of a connections job.  Index is the position of the user being scraped in the follows of the request,
+// Direction and PageToken are the page of that user's followers or followings that is scraped next,
+// Pages and Collected count the pages and follows of that list seen so far.
+type connectionsCheckpoint struct {
+	Index     int    `json:"index"`
+	Direction string `json:"direction"`
+	PageToken string `json:"page_token"`
+	Pages     int    `json:"pages"`
+	Collected int    `json:"collected"`
+}
+
+// connectionsJob handles a single connections job.  The payload is a models.ConnectionRequest,
+// the follows it refers to are read back from the database in the order they were stored, so the checkpointed index stays valid.
+func (app *application) connectionsJob(ctx context.Context, job *models.Job) error {
+	var stored models.ConnectionRequest
+	err := json.Unmarshal(job.Payload, &stored)
+	if err != nil {
+		return err
+	}
 
-	for request := range app.connectionsChan {
+	var checkpoint connectionsCheckpoint
+	err = loadCheckpoint(job, &checkpoint)
+	if err != nil {
+		return err
+	}
 
-		var currentUser *models.SimpleRequest
+	//the follows of the user are one hop further away from the participant
+	hop := stored.Hop + 1
+	if !app.expansion.expands(hop) {
+		app.infoLog.Printf("Connections of %s are beyond depth %d, not scraping connections", stored.Username, app.expansion.depth)
+		return nil
+	}
 
-		if len(request.follows) > app.followLimit {
+	request, err := app.populateConnectionRequest(&stored)
+	if err != nil {
+		return err
+	}
+
+	var currentUser *models.SimpleRequest
+
+	limit := app.followLimitsFor(stored.UID).connections
+	if overLimit(len(request.follows), limit) {
+		if !app.sampleOverLimit {
 			app.infoLog.Println("User has too many follows, not scraping connections")
-			err := models.DeleteConnectionRequest(app.connection, request.ID)
-			app.infoLog.Println("Deleting connection request with ID:", request.ID)
-			if err != nil {
-				app.errorLog.Println("Error deleting connection request:", err)
+			return nil
+		}
+		//only the first follows up to the limit are expanded, the order is stable so the checkpointed index stays valid
+		app.infoLog.Printf("User has too many follows, sampling connections of %d of %d follows", limit, len(request.follows))
+		request.follows = request.follows[:limit]
+	}
+
+	if checkpoint.Index > 0 {
+		app.infoLog.Printf("Resuming connections of %s at %d/%d", stored.Username, checkpoint.Index, len(request.follows))
+	}
+
+	for i := checkpoint.Index; i < len(request.follows); i++ {
+		//waits between users while connections are paused
+		err = app.control.wait(ctx, job.Kind)
+		if err != nil {
+			return err
+		}
+
+		user := request.follows[i]
+		//if the slice of follows is of followings of a user, that means the user is the followee, then that means the followerID and followerUsername is of the the other users.
+		if request.users == "followings" {
+			currentUser = &models.SimpleRequest{
+				UID:      user.FolloweeID,
+				Username: user.FolloweeUsername,
 			}
-			app.connectionsStatus = "idle"
+		} else if request.users == "followers" {
+			currentUser = &models.SimpleRequest{
+				UID:      user.FollowerID,
+				Username: user.FollowerUsername,
+			}
+		} else {
+			return fmt.Errorf("invalid user type %q", request.users)
+		}
+
+		app.status.worker(job.Kind).progress(currentUser.Username, i, len(request.follows))
+
+		//a checkpoint from another user is stale, the current user starts from their first page of followers
+		if checkpoint.Index != i {
+			checkpoint = connectionsCheckpoint{Index: i}
+		}
+
+		//looks up the user so that you can check for their follower and following count, a recently stored profile is not scraped again
+		currUser, err := app.lookupUser(ctx, currentUser.Username)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			app.errorLog.Println("Error scraping user:", err)
+			continue
+		}
+		if !models.AccountCollectable(currUser.AccountState) {
+			app.infoLog.Printf("User %s is %s, not scraping connections", currentUser.Username, currUser.AccountState)
+			continue
+		}
+		expand, reason, err := app.expandable(currUser)
+		if err != nil {
+			app.errorLog.Printf("Error checking expansion filters of %s: %s", currentUser.Username, err)
+			continue
+		}
+		if !expand {
+			app.infoLog.Printf("User %s %s, not scraping connections", currentUser.Username, reason)
 			continue
 		}
 
-		for i, user := range request.follows {
-			//if the slice of follows is of followings of a user, that means the user is the followee, then that means the followerID and followerUsername is of the the other users.
-			if request.users == "followings" {
-				currentUser = &models.SimpleRequest{
-					UID:      user.FolloweeID,
-					Username: user.FolloweeUsername,
-				}
-				app.connectionsStatus = fmt.Sprintf("%s, %d/%d", user.FollowerUsername, i, len(request.follows))
-			} else if request.users == "followers" {
-				currentUser = &models.SimpleRequest{
-					UID:      user.FollowerID,
-					Username: user.FollowerUsername,
-				}
-				app.connectionsStatus = fmt.Sprintf("%s, %d/%d", user.FolloweeUsername, i, len(request.follows))
-			} else {
-				app.errorLog.Println("Invalid user type")
-				continue
+		//below the expansion depth the complete lists of the user are collected by their own followers and followings jobs,
+		//which queue the connections of the accounts they add
+		if app.expansion.collectsLists(hop) {
+			err = app.queueExpansion(currUser, hop)
+			if err != nil {
+				return err
 			}
-
-			//scrapes the user so that you can check for their follower and following count
-			currUser, err := app.scrapeUser(currentUser.Username)
+			err = app.saveCheckpoint(job, &connectionsCheckpoint{Index: i + 1})
 			if err != nil {
-				app.errorLog.Println("Error scraping user:", err)
-				continue
+				return err
 			}
+			continue
+		}
 
-			var followers []*models.Follow
-			var followings []*models.Follow
-
-			//sends a request to the followers and followings of the currentUser if they fall below the limit
-			app.infoLog.Println("Sending request for followers for user:", currentUser.Username)
-			if currUser.Followers < app.followLimit {
-				followerChan := make(chan []*models.Follow)
-				followerRequest := &followRequest{
-					User:     currentUser,
-					upstream: followerChan,
+		//scrapes the followers and followings of the currentUser if they fall below the limit, or samples them if over limit lists are sampled
+		//only follows between users that are already in the database are added, page by page
+		if checkpoint.Direction == "" || checkpoint.Direction == "followers" {
+			if !overLimit(currUser.Followers, limit) || app.sampleOverLimit {
+				app.infoLog.Println("Sending request for followers for user:", currentUser.Username)
+				err = app.collectConnections(ctx, job, &checkpoint, app.followerQueue, currentUser, "followers", currUser.Followers, overLimit(currUser.Followers, limit))
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if state, ok := accountStateOf(err); ok {
+					app.updateAccountState(currentUser.UID, currentUser.Username, state)
+					currUser.AccountState = state
+				} else if err != nil {
+					app.errorLog.Printf("Error getting followers for %s: %s", currentUser.Username, err)
 				}
-				app.followerQueue <- followerRequest
-				followers = <-followerChan
-				close(followerChan)
-				app.infoLog.Printf("%d followers recieved for user: %s", len(followers), currentUser.Username)
 			}
+			//the followers pass is done, so a resumed job goes straight to the followings
+			checkpoint.Direction, checkpoint.PageToken = "followings", ""
+			checkpoint.Pages, checkpoint.Collected = 0, 0
+			err = app.saveCheckpoint(job, &checkpoint)
+			if err != nil {
+				return err
+			}
+		}
 
+		if (!overLimit(currUser.Following, limit) || app.sampleOverLimit) && models.AccountCollectable(currUser.AccountState) {
 			app.infoLog.Println("Sending request for followings for user:", currentUser.Username)
-			if currUser.Following < app.followLimit {
-				followingChan := make(chan []*models.Follow)
-				followingRequest := &followRequest{
-					User:     currentUser,
-					upstream: followingChan,
-				}
-				app.followQueue <- followingRequest
-				followings = <-followingChan
-				close(followingChan)
-				app.infoLog.Printf("%d followings recieved for user: %s", len(followings), currentUser.Username)
+			err = app.collectConnections(ctx, job, &checkpoint, app.followQueue, currentUser, "followings", currUser.Following, overLimit(currUser.Following, limit))
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
-
-			app.infoLog.Printf("Updating Connections for user: %s", currentUser.Username)
-			//iterates through all followers and checks if they are already in the database
-			//if they are already in the database, the follow is added since both users are already in the database
-			for _, follower := range followers {
-				if models.UserIDExists(app.connection, follower.FollowerID) {
-					if app.debug {
-						app.infoLog.Printf("Connection found. Follower: %s, Followee: %s", follower.FollowerUsername, follower.FolloweeUsername)
-					}
-					models.InsertFollow(app.connection, follower)
-				}
+			if state, ok := accountStateOf(err); ok {
+				app.updateAccountState(currentUser.UID, currentUser.Username, state)
+			} else if err != nil {
+				app.errorLog.Printf("Error getting followings for %s: %s", currentUser.Username, err)
 			}
+		}
 
-			//iterates through all followings and checks if they are already in the database
-			//if they are already in the database, the follow is added since both users are already in the database
-			for _, following := range followings {
-				if models.UserIDExists(app.connection, following.FolloweeID) {
-					app.infoLog.Printf("Connection found. Follower: %s, Followee: %s", following.FollowerUsername, following.FolloweeUsername)
-					models.InsertFollow(app.connection, following)
-				}
-			}
+		err = app.saveCheckpoint(job, &connectionsCheckpoint{Index: i + 1})
+		if err != nil {
+			return err
+		}
+	}
 
+	return nil
+}
+
+// queueExpansion queues followers and followings jobs for an account hop follows away from a participant.
+// Participants and accounts that already have a job of a kind queued or running are skipped.
+func (app *application) queueExpansion(user *models.User, hop int) error {
+	if models.StudentExists(app.connection, user.ID) {
+		return nil
+	}
+	request := &models.SimpleRequest{
+		UID:                user.ID,
+		Username:           user.Handle,
+		Scrape_connections: true,
+		Hop:                hop,
+	}
+	for _, kind := range []string{models.JobFollowers, models.JobFollowings} {
+		if models.UserJobActive(app.connection, kind, user.ID) {
+			continue
+		}
+		app.infoLog.Printf("Queueing %s job for %s at hop %d", kind, user.Handle, hop)
+		_, err := app.enqueueJob(kind, user.ID, request)
+		if err != nil {
+			return fmt.Errorf("error queueing %s job: %w", kind, err)
 		}
+	}
+	return nil
+}
 
-		err := models.DeleteConnectionRequest(app.connection, request.ID)
-		app.infoLog.Println("Deleting connection request with ID:", request.ID)
+// collectConnections pages through the followers or followings of a user for a connections job, starting at the checkpointed page.
+// Only follows where both users are already in the database are added.  The checkpoint is saved after every page.
+// A sampled list stops after samplePages pages and its follows are flagged as partial.  The coverage of the list is recorded once it stops,
+// expected is the number of follows the profile reports.
+func (app *application) collectConnections(ctx context.Context, job *models.Job, checkpoint *connectionsCheckpoint, queue chan *followRequest, user *models.SimpleRequest, direction string, expected int, sample bool) error {
+	checkpoint.Direction = direction
+	//a sample that already has all of its pages is not collected again on resume
+	if !sample || checkpoint.Pages < app.samplePages {
+		err := app.collectFollows(ctx, job, queue, user, checkpoint.PageToken, func(follows []*models.Follow, next string) error {
+			app.storeConnections(user, follows, direction, sample)
+			checkpoint.PageToken = next
+			checkpoint.Pages++
+			checkpoint.Collected += len(follows)
+			err := app.saveCheckpoint(job, checkpoint)
+			if err == nil && sample && checkpoint.Pages >= app.samplePages {
+				return errEnoughPages
+			}
+			return err
+		})
 		if err != nil {
-			app.errorLog.Println("Error deleting connection request:", err)
+			return err
 		}
+	}
 
-		app.connectionsStatus = "idle"
+	return models.UpsertFollowCoverage(app.connection, &models.FollowCoverage{
+		UserID:    user.UID,
+		Direction: direction,
+		Collected: checkpoint.Collected,
+		Expected:  expected,
+		Partial:   checkpoint.PageToken != "",
+	})
+}
 
+// storeConnections adds the follows of a page of followers or followings where the other user is already in the database.
+// Errors are logged, a follow that can not be stored does not stop the page.
+func (app *application) storeConnections(user *models.SimpleRequest, follows []*models.Follow, direction string, partial bool) {
+	app.infoLog.Printf("%d %s recieved for user: %s", len(follows), direction, user.Username)
+	//the other user is the follower in a list of followers, and the followee in a list of followings
+	otherIDs := make([]int64, len(follows))
+	for i, follow := range follows {
+		otherIDs[i] = follow.FolloweeID
+		if direction == "followers" {
+			otherIDs[i] = follow.FollowerID
+		}
+	}
+	existing, err := models.UserIDsExist(app.connection, otherIDs)
+	if err != nil {
+		app.errorLog.Println("Error checking connections:", err)
+		return
 	}
 
+	//if they are already in the database, the follow is added since both users are already in the database
+	var connections []*models.Follow
+	for i, follow := range follows {
+		if existing[otherIDs[i]] {
+			if app.debug {
+				app.infoLog.Printf("Connection found. Follower: %s, Followee: %s", follow.FollowerUsername, follow.FolloweeUsername)
+			}
+			follow.Partial = partial
+			connections = append(connections, follow)
+		}
+	}
+	err = models.ObserveFollows(app.connection, connections, time.Now().UTC(), false)
+	if err != nil {
+		app.errorLog.Println("Error storing connections:", err)
+	}
 }
 
-// FollowerQueue is a queue that reads from the follower channel for request structs which contain the channel where a slice of pointers to models.follow structs are returned.
-func (app *application) FollowerQueue() {
+// FollowerQueue is a queue that reads from the follower channel for request structs which contain the channel where a page of followers, or the error that stopped the scrape, is returned.
+// It stops when ctx is cancelled.
+func (app *application) FollowerQueue(ctx context.Context) {
 	//reads from follower request channel and scrapes the requests
-	for currRequest := range app.followerQueue {
+	for {
+		var currRequest *followRequest
+		select {
+		case currRequest = <-app.followerQueue:
+		case <-ctx.Done():
+			return
+		}
 
-		followers, err := app.getFollowers(currRequest.User)
+		//holds the page while the job kind that asked for it is paused
+		err := app.control.wait(currRequest.ctx, currRequest.kind)
 		if err != nil {
-			app.errorLog.Println("Error getting followers for: ", currRequest.User.Username)
+			currRequest.upstream <- followResult{err: err}
 			continue
 		}
 
-		currRequest.upstream <- followers
+		followers, next, err := app.source.FollowersPage(currRequest.ctx, currRequest.User, currRequest.PageToken)
+		if err != nil {
+			app.errorLog.Println("Error getting followers for: ", currRequest.User.Username)
+		}
 
-		//sleeps for a minute to avoid rate limiting
-		time.Sleep(time.Minute)
+		currRequest.upstream <- followResult{follows: followers, next: next, err: err}
 
 	}
 }
 
-// FollowingQueue is a queue that reads from the following channel for request structs which contain the channel where a slice of pointers to models.folow structs are returned.
-func (app *application) FollowingQueue() {
+// FollowingQueue is a queue that reads from the following channel for request structs which contain the channel where a page of followings, or the error that stopped the scrape, is returned.
+// It stops when ctx is cancelled.
+func (app *application) FollowingQueue(ctx context.Context) {
 	//reads from following request channel and scrapes the requests
-	for currRequest := range app.followQueue {
+	for {
+		var currRequest *followRequest
+		select {
+		case currRequest = <-app.followQueue:
+		case <-ctx.Done():
+			return
+		}
 
-		followings, err := app.getFollows(currRequest.User)
+		//holds the page while the job kind that asked for it is paused
+		err := app.control.wait(currRequest.ctx, currRequest.kind)
 		if err != nil {
-			app.errorLog.Println("Error getting followings for: ", currRequest.User.Username)
+			currRequest.upstream <- followResult{err: err}
 			continue
 		}
 
-		currRequest.upstream <- followings
+		followings, next, err := app.source.FollowingsPage(currRequest.ctx, currRequest.User, currRequest.PageToken)
+		if err != nil {
+			app.errorLog.Println("Error getting followings for: ", currRequest.User.Username)
+		}
 
-		//sleeps for a minute to avoid rate limiting
-		time.Sleep(time.Minute)
+		currRequest.upstream <- followResult{follows: followings, next: next, err: err}
 
 	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	pgxpool "github.com/jackc/pgx/v4/pgxpool"
+	twitterscraper "github.com/n0madic/twitter-scraper"
+	"github.com/rainbowriverrr/F3Ytwitter/internal/models"
+	"github.com/rainbowriverrr/F3Ytwitter/internal/scoring"
+)
+
+// testLogWriter writes log lines to the test log, so they are only shown for failed tests.
+type testLogWriter struct {
+	t *testing.T
+}
+
+func (w testLogWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.t.Log(string(p))
+	return len(p), nil
+}
+
+// newTestApp creates an application that reads twitter from src and stores into the database at TEST_DATABASE_URL.
+// Every table of that database is dropped and created again, so it must be a database only used for tests.
+// The test is skipped when TEST_DATABASE_URL is not set.
+func newTestApp(t *testing.T, src TwitterSource) (*application, context.Context) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	conn, err := pgxpool.Connect(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+
+	app := &application{
+		errorLog:      log.New(testLogWriter{t}, "ERROR: ", 0),
+		infoLog:       log.New(io.Discard, "", 0),
+		connection:    conn,
+		source:        src,
+		jobSignals:    newJobSignals(),
+		retryPolicies: map[string]retryPolicy{},
+		followQueue:   make(chan *followRequest),
+		followerQueue: make(chan *followRequest),
+		status:        newStatusRegistry(),
+		control:       newJobControl(),
+		tweetOverlap:  48 * time.Hour,
+		followLimits:  followLimits{followers: 1000, followings: 1000, connections: 1000},
+		expansion:     expansionPolicy{depth: 0},
+		profiles:      newProfileLookup(0),
+		scorer:        scoring.New(map[string]float64{"good": 1.9}, []string{"bad"}),
+	}
+	err = app.resetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go app.FollowerQueue(ctx)
+	go app.FollowingQueue(ctx)
+	return app, ctx
+}
+
+// runNextJob leases the next job of a kind, runs it with handle and marks it done.  The test fails if there is no job or it fails.
+func runNextJob(t *testing.T, app *application, ctx context.Context, kind string, handle func(ctx context.Context, job *models.Job) error) {
+	t.Helper()
+	job, err := models.LeaseJob(app.connection, kind)
+	if err != nil {
+		t.Fatalf("leasing %s job: %s", kind, err)
+	}
+	err = handle(ctx, job)
+	if err != nil {
+		t.Fatalf("%s job: %s", kind, err)
+	}
+	err = models.CompleteJob(app.connection, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countRows runs a count query and returns the count.
+func countRows(t *testing.T, app *application, statement string, args ...any) int {
+	t.Helper()
+	var count int
+	err := app.connection.QueryRow(context.Background(), statement, args...).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// TestParticipantJobs runs the jobs of a new participant against fixtures: the profile job, the followers and followings jobs it queues,
+// and the tweets job, then checks what ended up in the database.
+func TestParticipantJobs(t *testing.T) {
+	now := time.Now().UTC()
+	src := newFixtureSource()
+	src.AddProfile(twitterscraper.Profile{UserID: "10", Username: "school", Name: "School"})
+	src.AddProfile(twitterscraper.Profile{UserID: "100", Username: "alice", Name: "Alice", FollowersCount: 1, FollowingCount: 1})
+	src.AddProfile(twitterscraper.Profile{UserID: "200", Username: "bob", Name: "Bob"})
+	src.AddProfile(twitterscraper.Profile{UserID: "300", Username: "carol", Name: "Carol"})
+	src.AddFollowers(100, []fixtureUser{{ID: 200, Username: "bob", CreatedAt: now}})
+	src.AddFollowings(100, []fixtureUser{{ID: 300, Username: "carol", CreatedAt: now}})
+	src.AddTweets("alice", []*twitterscraper.Tweet{
+		{ID: "1001", UserID: "100", Username: "alice", Text: "good morning @bob #hello", Hashtags: []string{"hello"}, TimeParsed: now.Add(-time.Hour)},
+		{ID: "1000", UserID: "100", Username: "alice", Text: "first tweet", TimeParsed: now.Add(-2 * time.Hour)},
+	})
+
+	app, ctx := newTestApp(t, src)
+
+	err := models.InsertUser(app.connection, &models.User{ID: 10, Handle: "school"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.InsertSchool(app.connection, &models.School{ID: 1, Name: "School", User_ID: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.enqueueJob(models.JobProfile, 0, simplifiedUser{
+		Username:            "alice",
+		IsParticipant:       true,
+		ParticipantSchoolID: 1,
+		ParticipantCohort:   2022,
+		StartDate:           now.Add(-24 * time.Hour),
+		ScrapeConnections:   true,
+		ScrapeContent:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runNextJob(t, app, ctx, models.JobProfile, app.profileJob)
+	if !models.StudentExists(app.connection, 100) {
+		t.Fatal("participant was not added as a student")
+	}
+
+	runNextJob(t, app, ctx, models.JobFollowers, app.followersJob)
+	runNextJob(t, app, ctx, models.JobFollowings, app.followingsJob)
+	if got := countRows(t, app, "SELECT COUNT(*) FROM follows WHERE follower_id=200 AND followee_id=100"); got != 1 {
+		t.Errorf("got %d follows of bob to alice, want 1", got)
+	}
+	if got := countRows(t, app, "SELECT COUNT(*) FROM follows WHERE follower_id=100 AND followee_id=300"); got != 1 {
+		t.Errorf("got %d follows of alice to carol, want 1", got)
+	}
+
+	runNextJob(t, app, ctx, models.JobTweets, app.tweetsJob)
+	if got := countRows(t, app, "SELECT COUNT(*) FROM tweets WHERE user_id=100"); got != 2 {
+		t.Errorf("got %d tweets of alice, want 2", got)
+	}
+	if got := countRows(t, app, "SELECT COUNT(*) FROM mentions WHERE tweet_id=1001 AND user_id=200"); got != 1 {
+		t.Errorf("got %d mentions of bob, want 1", got)
+	}
+	if got := countRows(t, app, "SELECT COUNT(*) FROM hashtags WHERE tweet_id=1001 AND tag='hello'"); got != 1 {
+		t.Errorf("got %d hashtags, want 1", got)
+	}
+	if got := countRows(t, app, "SELECT COUNT(*) FROM tweet_scores WHERE tweet_id=1001 AND sentiment>0"); got != 1 {
+		t.Errorf("got %d positive scores, want 1", got)
+	}
+
+	//depth 0 collects no connections, so every job has run
+	if got := countRows(t, app, "SELECT COUNT(*) FROM jobs WHERE state=$1", models.JobQueued); got != 0 {
+		t.Errorf("got %d queued jobs left, want 0", got)
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// batchSender is a connection pool or a transaction.
+type batchSender interface {
+	SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults
+}
+
+// execBatch sends every statement queued in batch in a single round trip, and returns the first error.
+func execBatch(conn batchSender, batch *pgx.Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	results := conn.SendBatch(context.Background(), batch)
+	for i := 0; i < batch.Len(); i++ {
+		_, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return err
+		}
+	}
+	return results.Close()
+}
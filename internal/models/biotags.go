@@ -1,9 +1,9 @@
 package models
 
 import (
-	"context"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -14,23 +14,14 @@ type BioTag struct {
 	CollectedAt     *time.Time `json:"collected_at"`
 }
 
-// InsertBioTag inserts a BioTag object into the database.  No checking.
-func InsertBioTag(conn *pgxpool.Pool, bioTag *BioTag) error {
-	if TagExists(conn, bioTag.UserID, bioTag.MentionedUserID) {
-		return nil
-	}
-	statement := "INSERT INTO bio_tags(user_id, mentioned_user_id, collected_at) VALUES($1, $2, $3)"
-	_, err := conn.Exec(context.Background(), statement, bioTag.UserID, bioTag.MentionedUserID, bioTag.CollectedAt)
-	return err
-}
+// insertBioTag adds a bio tag, a bio tag that is already in the database is left alone.
+const insertBioTag = "INSERT INTO bio_tags(user_id, mentioned_user_id, collected_at) VALUES($1, $2, $3) ON CONFLICT (user_id, mentioned_user_id) DO NOTHING"
 
-// TagExists checks if a tag exists in the database given a UserID and MentionedUserID
-func TagExists(conn *pgxpool.Pool, userID int64, mentionedUserID int64) bool {
-	var exists bool
-	statement := "SELECT EXISTS(SELECT 1 FROM bio_tags WHERE user_id=$1 AND mentioned_user_id=$2)"
-	err := conn.QueryRow(context.Background(), statement, userID, mentionedUserID).Scan(&exists)
-	if err != nil {
-		return false
+// InsertBioTags inserts a slice of bio tags in a single batch.  Bio tags that already exist are skipped.
+func InsertBioTags(conn *pgxpool.Pool, bioTags []*BioTag) error {
+	batch := &pgx.Batch{}
+	for _, bioTag := range bioTags {
+		batch.Queue(insertBioTag, bioTag.UserID, bioTag.MentionedUserID, bioTag.CollectedAt)
 	}
-	return exists
+	return execBatch(conn, batch)
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// FollowCoverage is how much of the followers (direction "followers") or followings (direction "followings") of a user was collected the last time.
+// Expected is the count on the user's profile, Partial is set when the list was over the follow limit and only a sample of it was collected.
+type FollowCoverage struct {
+	UserID    int64     `json:"user_id"`
+	Direction string    `json:"direction"`
+	Collected int       `json:"collected"`
+	Expected  int       `json:"expected"`
+	Partial   bool      `json:"partial"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Ratio returns the share of the list that was collected, between 0 and 1.  A list that is empty on the profile counts as complete.
+func (c *FollowCoverage) Ratio() float64 {
+	if c.Expected <= 0 || c.Collected >= c.Expected {
+		return 1
+	}
+	return float64(c.Collected) / float64(c.Expected)
+}
+
+// UpsertFollowCoverage stores the coverage of the last collection of a user's followers or followings, replacing the previous one.
+func UpsertFollowCoverage(conn *pgxpool.Pool, coverage *FollowCoverage) error {
+	statement := `INSERT INTO follow_coverage(user_id, direction, collected, expected, ratio, partial, updated_at) VALUES($1, $2, $3, $4, $5, $6, now())
+		ON CONFLICT (user_id, direction) DO UPDATE SET collected=$3, expected=$4, ratio=$5, partial=$6, updated_at=now()`
+	_, err := conn.Exec(context.Background(), statement, coverage.UserID, coverage.Direction, coverage.Collected, coverage.Expected, coverage.Ratio(), coverage.Partial)
+	return err
+}
+
+// GetFollowCoverage returns the coverage of the followers and followings of a user, followers first.
+func GetFollowCoverage(conn *pgxpool.Pool, userID int64) ([]FollowCoverage, error) {
+	statement := "SELECT user_id, direction, collected, expected, partial, updated_at FROM follow_coverage WHERE user_id=$1 ORDER BY direction"
+	rows, err := conn.Query(context.Background(), statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var coverage []FollowCoverage
+	for rows.Next() {
+		var c FollowCoverage
+		err = rows.Scan(&c.UserID, &c.Direction, &c.Collected, &c.Expected, &c.Partial, &c.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		coverage = append(coverage, c)
+	}
+	return coverage, rows.Err()
+}
@@ -8,4 +8,6 @@ var (
 	ErrNotFound = errors.New("models: no record found")
 
 	ErrInvalidCredits = errors.New("models: invalid credits")
+
+	ErrNoJob = errors.New("models: no queued job")
 )
@@ -4,113 +4,237 @@ import (
 	"context"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// Follow is an edge of the follow graph.  FirstSeen and LastSeen are the first and last collection the edge was seen in,
+// EndedAt is set when the edge was missing from a complete collection of the followers or followings it belongs to.
+// Partial is set while the edge has only been seen in truncated samples of lists that were over the follow limit.
 type Follow struct {
-	ID               int64     `json:"id"`
-	FollowerID       int64     `json:"follower_id"`
-	FolloweeID       int64     `json:"followee_id"`
-	FollowerUsername string    `json:"follower_username"`
-	FolloweeUsername string    `json:"followee_username"`
-	CreatedAt        time.Time `json:"created_at"`
-	CollectedAt      time.Time `json:"collected_at"`
+	ID               int64      `json:"id"`
+	FollowerID       int64      `json:"follower_id"`
+	FolloweeID       int64      `json:"followee_id"`
+	FollowerUsername string     `json:"follower_username"`
+	FolloweeUsername string     `json:"followee_username"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CollectedAt      time.Time  `json:"collected_at"`
+	FirstSeen        time.Time  `json:"first_seen"`
+	LastSeen         time.Time  `json:"last_seen"`
+	EndedAt          *time.Time `json:"ended_at"`
+	Partial          bool       `json:"partial"`
 }
 
-// InsertFollow inserts a Follow object into the database.
-func InsertFollow(conn *pgxpool.Pool, follow *Follow) error {
-	if FollowExists(conn, follow) {
-		return nil
-	}
-	statement := "INSERT INTO follows(follower_id, followee_id, created_at, collected_at) VALUES($1, $2, $3, $4)"
-	_, err := conn.Exec(context.Background(), statement, follow.FollowerID, follow.FolloweeID, follow.CreatedAt, follow.CollectedAt)
-	return err
-}
+// selectFollows selects the current follows with the handles of both users, in the order they were inserted.
+// The condition on the follows is added after it.
+const selectFollows = `SELECT follows.id, follows.follower_id, follows.followee_id, follows.created_at, follows.collected_at, follows.first_seen,
+		follows.last_seen, follows.ended_at, follows.partial, follower.handle, followee.handle
+	FROM follows JOIN users follower ON follower.id=follows.follower_id JOIN users followee ON followee.id=follows.followee_id
+	WHERE follows.ended_at IS NULL AND `
 
-// GetFollowers retrieves all followers of a user returns a slice of pointers to Follow objects from the database if they exist.  Otherwise, it returns nil.
+// GetFollowers retrieves all current followers of a user, in the order they were inserted, and returns a slice of pointers to Follow objects from the database if they exist.  Otherwise, it returns nil.
+// Follows that have ended are left out.
 func GetFollowers(conn *pgxpool.Pool, uid int64) ([]*Follow, error) {
-	var follows []*Follow
-	var err error
-	statement := "SELECT * FROM follows WHERE followee_id=$1"
-	rows, err := conn.Query(context.Background(), statement, uid)
+	return queryFollows(conn, selectFollows+"follows.followee_id=$1 ORDER BY follows.id", uid)
+}
+
+// GetFollows retrieves all current follows of a user, in the order they were inserted, and returns a slice of pointers to Follow objects from the database if they exist.  Otherwise, it returns nil.
+// Follows that have ended are left out.
+func GetFollows(conn *pgxpool.Pool, uid int64) ([]*Follow, error) {
+	return queryFollows(conn, selectFollows+"follows.follower_id=$1 ORDER BY follows.id", uid)
+}
+
+// queryFollows runs a selectFollows statement and scans the follows it returns.
+func queryFollows(conn *pgxpool.Pool, statement string, args ...interface{}) ([]*Follow, error) {
+	rows, err := conn.Query(context.Background(), statement, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
+	var follows []*Follow
 	for rows.Next() {
 		var follow Follow
-		err = rows.Scan(&follow.ID, &follow.FollowerID, &follow.FolloweeID, &follow.CreatedAt, &follow.CollectedAt)
+		err = rows.Scan(&follow.ID, &follow.FollowerID, &follow.FolloweeID, &follow.CreatedAt, &follow.CollectedAt, &follow.FirstSeen,
+			&follow.LastSeen, &follow.EndedAt, &follow.Partial, &follow.FollowerUsername, &follow.FolloweeUsername)
 		if err != nil {
 			return nil, err
 		}
+		follows = append(follows, &follow)
+	}
+	return follows, rows.Err()
+}
 
-		follow.FollowerUsername, err = GetUsernameByID(conn, follow.FollowerID)
-		if err != nil {
-			return nil, err
-		}
+// CountFollowedParticipants returns how many participants a user currently follows, as far as the stored follows know.
+func CountFollowedParticipants(conn *pgxpool.Pool, userID int64) (int, error) {
+	var count int
+	statement := `SELECT count(*) FROM follows JOIN users ON users.id=follows.followee_id
+		WHERE follows.follower_id=$1 AND follows.ended_at IS NULL AND users.is_participant`
+	err := conn.QueryRow(context.Background(), statement, userID).Scan(&count)
+	return count, err
+}
 
-		follow.FolloweeUsername, err = GetUsernameByID(conn, follow.FolloweeID)
-		if err != nil {
-			return nil, err
-		}
+// Follow event kinds.
+const (
+	FollowGained = "gained"
+	FollowLost   = "lost"
+)
 
-		follows = append(follows, &follow)
-	}
-	return follows, nil
+// FollowEvent is a follow that started or ended between two collections.
+type FollowEvent struct {
+	FollowerID       int64     `json:"follower_id"`
+	FolloweeID       int64     `json:"followee_id"`
+	FollowerUsername string    `json:"follower_username"`
+	FolloweeUsername string    `json:"followee_username"`
+	Event            string    `json:"event"`
+	ObservedAt       time.Time `json:"observed_at"`
 }
 
-// GetFollows retrieves all follows of a user and returns a slice of pointers to Follow objects from the database if they exist.  Otherwise, it returns nil.
-func GetFollows(conn *pgxpool.Pool, uid int64) ([]*Follow, error) {
-	var follows []*Follow
-	var err error
-	statement := "SELECT * FROM follows WHERE follower_id=$1"
-	rows, err := conn.Query(context.Background(), statement, uid)
+// EndMissingFollows ends the followers (direction "followers") or followings (direction "followings") of a user
+// that were not seen since a complete collection started at snapshotAt, and records a lost event for each of them.
+// Returns the number of ended follows.
+func EndMissingFollows(conn *pgxpool.Pool, userID int64, direction string, snapshotAt time.Time) (int, error) {
+	column := "follower_id"
+	if direction == "followers" {
+		column = "followee_id"
+	}
+	statement := "UPDATE follows SET ended_at=$1 WHERE " + column + "=$2 AND ended_at IS NULL AND last_seen<$1 RETURNING follower_id, followee_id"
+	rows, err := conn.Query(context.Background(), statement, snapshotAt, userID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	var ended [][2]int64
 	for rows.Next() {
-		var follow Follow
-		err = rows.Scan(&follow.ID, &follow.FollowerID, &follow.FolloweeID, &follow.CreatedAt, &follow.CollectedAt)
+		var edge [2]int64
+		err = rows.Scan(&edge[0], &edge[1])
 		if err != nil {
-			return nil, err
+			rows.Close()
+			return 0, err
 		}
+		ended = append(ended, edge)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
 
-		follow.FollowerUsername, err = GetUsernameByID(conn, follow.FollowerID)
+	for _, edge := range ended {
+		err = insertFollowEvent(conn, edge[0], edge[1], FollowLost, snapshotAt)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
+	}
+	return len(ended), nil
+}
+
+// observeFollowsStatements record a page of follows copied into follows_staging, with $1 the time they were seen and $2 whether new follows are recorded as gained.
+// The events are recorded before the upsert, while the follows that are new or had ended can still be told apart.
+var observeFollowsStatements = []string{
+	`INSERT INTO follow_events(follower_id, followee_id, event, observed_at)
+		SELECT DISTINCT staged.follower_id, staged.followee_id, 'gained', $1::timestamp FROM follows_staging staged
+		LEFT JOIN follows ON follows.follower_id=staged.follower_id AND follows.followee_id=staged.followee_id
+		WHERE follows.ended_at IS NOT NULL OR (follows.id IS NULL AND $2::boolean)`,
+	`INSERT INTO follows(follower_id, followee_id, created_at, collected_at, first_seen, last_seen, partial)
+		SELECT DISTINCT ON (follower_id, followee_id) follower_id, followee_id, created_at, collected_at, $1::timestamp, $1::timestamp, partial
+		FROM follows_staging ORDER BY follower_id, followee_id, partial
+		ON CONFLICT (follower_id, followee_id) DO UPDATE SET last_seen=GREATEST(follows.last_seen, EXCLUDED.last_seen), ended_at=NULL,
+		partial=(follows.partial AND EXCLUDED.partial)`,
+}
+
+// ObserveFollows records that a page of follows was seen in a collection at seenAt.  Follows that are new are inserted, follows that had ended
+// are started again, and the last_seen of known follows is moved to seenAt.  A gained event is recorded for every follow that started again,
+// and for new follows if recordNew is set, which is only the case when an earlier complete collection did not have them.
+// The follows are copied into a staging table and upserted from there in a single transaction, so a page takes a few round trips instead of a few per follow.
+func ObserveFollows(conn *pgxpool.Pool, follows []*Follow, seenAt time.Time, recordNew bool) error {
+	if len(follows) == 0 {
+		return nil
+	}
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	statement := `CREATE TEMP TABLE follows_staging(
+		follower_id bigint,
+		followee_id bigint,
+		created_at timestamp,
+		collected_at timestamp,
+		partial boolean
+		) ON COMMIT DROP`
+	_, err = tx.Exec(context.Background(), statement)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]interface{}, len(follows))
+	for i, follow := range follows {
+		rows[i] = []interface{}{follow.FollowerID, follow.FolloweeID, follow.CreatedAt, follow.CollectedAt, follow.Partial}
+	}
+	columns := []string{"follower_id", "followee_id", "created_at", "collected_at", "partial"}
+	_, err = tx.CopyFrom(context.Background(), pgx.Identifier{"follows_staging"}, columns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return err
+	}
 
-		follow.FolloweeUsername, err = GetUsernameByID(conn, follow.FolloweeID)
+	for _, statement := range observeFollowsStatements {
+		_, err = tx.Exec(context.Background(), statement, seenAt, recordNew)
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		follows = append(follows, &follow)
 	}
-	return follows, nil
+	return tx.Commit(context.Background())
 }
 
-// FollowExists checks if a follow exists in the database.  Returns true if it does.  Otherwise, it returns false.
-func FollowExists(conn *pgxpool.Pool, follow *Follow) bool {
+// insertFollowEvent records that a follow was gained or lost.
+func insertFollowEvent(conn *pgxpool.Pool, followerID int64, followeeID int64, event string, observedAt time.Time) error {
+	statement := "INSERT INTO follow_events(follower_id, followee_id, event, observed_at) VALUES($1, $2, $3, $4)"
+	_, err := conn.Exec(context.Background(), statement, followerID, followeeID, event, observedAt)
+	return err
+}
+
+// InsertFollowSnapshot records that the followers (direction "followers") or followings (direction "followings") of a user
+// were collected completely, starting at startedAt.
+func InsertFollowSnapshot(conn *pgxpool.Pool, userID int64, direction string, startedAt time.Time, edges int) error {
+	statement := "INSERT INTO follow_snapshots(user_id, direction, started_at, completed_at, edges) VALUES($1, $2, $3, now(), $4)"
+	_, err := conn.Exec(context.Background(), statement, userID, direction, startedAt, edges)
+	return err
+}
+
+// FollowSnapshotExists checks if the followers or followings of a user have been collected completely before.
+func FollowSnapshotExists(conn *pgxpool.Pool, userID int64, direction string) bool {
 	var exists bool
-	statement := "SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id=$1 AND followee_id=$2)"
-	err := conn.QueryRow(context.Background(), statement, follow.FollowerID, follow.FolloweeID).Scan(&exists)
+	statement := "SELECT EXISTS(SELECT 1 FROM follow_snapshots WHERE user_id=$1 AND direction=$2)"
+	err := conn.QueryRow(context.Background(), statement, userID, direction).Scan(&exists)
 	if err != nil {
 		return false
 	}
 	return exists
 }
 
-// AddFollows takes a slice of pointers to Follow objects and adds them to the database if they do not already exist.
-func AddFollows(conn *pgxpool.Pool, follows []*Follow) error {
-	for _, follow := range follows {
-		if !FollowExists(conn, follow) {
-			err := InsertFollow(conn, follow)
-			if err != nil {
-				return err
-			}
+// GetFollowEvents returns the follows a user gained and lost as a follower or followee between two times, oldest first.
+func GetFollowEvents(conn *pgxpool.Pool, userID int64, from time.Time, to time.Time) ([]FollowEvent, error) {
+	statement := `SELECT follow_events.follower_id, follow_events.followee_id, COALESCE(follower.handle, ''), COALESCE(followee.handle, ''),
+		follow_events.event, follow_events.observed_at
+		FROM follow_events
+		LEFT JOIN users follower ON follower.id=follow_events.follower_id
+		LEFT JOIN users followee ON followee.id=follow_events.followee_id
+		WHERE (follow_events.follower_id=$1 OR follow_events.followee_id=$1) AND follow_events.observed_at>=$2 AND follow_events.observed_at<$3
+		ORDER BY follow_events.observed_at, follow_events.id`
+	rows, err := conn.Query(context.Background(), statement, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []FollowEvent
+	for rows.Next() {
+		var event FollowEvent
+		err = rows.Scan(&event.FollowerID, &event.FolloweeID, &event.FollowerUsername, &event.FolloweeUsername, &event.Event, &event.ObservedAt)
+		if err != nil {
+			return nil, err
 		}
+		events = append(events, event)
 	}
-	return nil
+	return events, rows.Err()
 }
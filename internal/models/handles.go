@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// resolveHandle selects the ID of the user a handle ($1) belongs to.  The user that has the handle now comes first,
+// then the user that had it most recently, so handles keep working after an account is renamed.
+const resolveHandle = `SELECT id FROM (
+		SELECT id, 0 AS rank, collected_at AS seen FROM users WHERE handle ILIKE $1
+		UNION ALL
+		SELECT handle_history.user_id, 1, handle_history.last_seen FROM handle_history JOIN users ON users.id=handle_history.user_id WHERE lower(handle_history.handle)=lower($1)
+	) handles ORDER BY rank, seen DESC NULLS LAST LIMIT 1`
+
+// Handle is a handle a user has had, and when it was first and last seen on their account.
+type Handle struct {
+	UserID    int64     `json:"user_id"`
+	Handle    string    `json:"handle"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// RecordHandle records that a user had a handle at seenAt.  A handle that is already in the user's history has its last_seen moved up.
+func RecordHandle(conn *pgxpool.Pool, userID int64, handle string, seenAt time.Time) error {
+	statement := "UPDATE handle_history SET last_seen=GREATEST(last_seen, $3) WHERE user_id=$1 AND lower(handle)=lower($2)"
+	tag, err := conn.Exec(context.Background(), statement, userID, handle, seenAt)
+	if err != nil || tag.RowsAffected() > 0 {
+		return err
+	}
+	statement = "INSERT INTO handle_history(user_id, handle, first_seen, last_seen) VALUES($1, $2, $3, $3)"
+	_, err = conn.Exec(context.Background(), statement, userID, handle, seenAt)
+	return err
+}
+
+// GetHandleHistory returns every handle a user has had, most recent first.
+func GetHandleHistory(conn *pgxpool.Pool, userID int64) ([]Handle, error) {
+	statement := "SELECT user_id, handle, first_seen, last_seen FROM handle_history WHERE user_id=$1 ORDER BY last_seen DESC"
+	rows, err := conn.Query(context.Background(), statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handles []Handle
+	for rows.Next() {
+		var handle Handle
+		err = rows.Scan(&handle.UserID, &handle.Handle, &handle.FirstSeen, &handle.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		handles = append(handles, handle)
+	}
+	return handles, rows.Err()
+}
+
+// ResolveHandles returns the IDs of the users a set of handles belong to, keyed by lower case handle, with the same precedence as a single handle:
+// the user that has the handle now, then the user that had it most recently.  Handles that belong to no user are left out.
+func ResolveHandles(conn *pgxpool.Pool, handles []string) (map[string]int64, error) {
+	lowered := make([]string, len(handles))
+	for i, handle := range handles {
+		lowered[i] = strings.ToLower(handle)
+	}
+	statement := `SELECT DISTINCT ON (handle) handle, id FROM (
+		SELECT lower(handle) AS handle, id, 0 AS rank, collected_at AS seen FROM users WHERE lower(handle) = ANY($1)
+		UNION ALL
+		SELECT lower(handle_history.handle), handle_history.user_id, 1, handle_history.last_seen FROM handle_history JOIN users ON users.id=handle_history.user_id WHERE lower(handle_history.handle) = ANY($1)
+	) handles ORDER BY handle, rank, seen DESC NULLS LAST`
+	rows, err := conn.Query(context.Background(), statement, lowered)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	IDs := make(map[string]int64)
+	for rows.Next() {
+		var handle string
+		var ID int64
+		err = rows.Scan(&handle, &ID)
+		if err != nil {
+			return nil, err
+		}
+		IDs[handle] = ID
+	}
+	return IDs, rows.Err()
+}
+
+// DuplicateUsers is a handle that more than one user row has.  The ID of a user is its Twitter account ID, so these are different accounts
+// and all but one of them have a stale handle.
+type DuplicateUsers struct {
+	Handle  string
+	UserIDs []int64
+}
+
+// GetDuplicateUsers returns every handle that more than one user row has, ignoring case.
+func GetDuplicateUsers(conn *pgxpool.Pool) ([]DuplicateUsers, error) {
+	statement := "SELECT lower(handle), array_agg(id ORDER BY id) FROM users GROUP BY lower(handle) HAVING COUNT(*) > 1"
+	rows, err := conn.Query(context.Background(), statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duplicates []DuplicateUsers
+	for rows.Next() {
+		var duplicate DuplicateUsers
+		err = rows.Scan(&duplicate.Handle, &duplicate.UserIDs)
+		if err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+	return duplicates, rows.Err()
+}
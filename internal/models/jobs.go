@@ -0,0 +1,294 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Job kinds.  Every stage of the scrape pipeline is a kind of job.
+const (
+	JobProfile     = "profile"
+	JobTweets      = "tweets"
+	JobFollowers   = "followers"
+	JobFollowings  = "followings"
+	JobConnections = "connections"
+)
+
+// Job states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a unit of work in the scrape pipeline.  Payload is the json encoded request the worker of that kind expects.
+// Checkpoint is the progress a worker saved while running the job, so an interrupted job can resume where it stopped.
+// A queued job is not leased before RunAfter, which is how retries are backed off.
+// UserID is the user the job is about, or 0 if it was not known when the job was queued.
+type Job struct {
+	ID         int64     `json:"id"`
+	Kind       string    `json:"kind"`
+	UserID     int64     `json:"user_id"`
+	Payload    []byte    `json:"payload"`
+	State      string    `json:"state"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error"`
+	Checkpoint string    `json:"checkpoint"`
+	RunAfter   time.Time `json:"run_after"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// InsertJob inserts a queued Job into the database.  Returns the ID of the inserted row.
+func InsertJob(conn *pgxpool.Pool, job *Job) (int64, error) {
+	var id int64
+	var userID *int64
+	if job.UserID != 0 {
+		userID = &job.UserID
+	}
+	statement := "INSERT INTO jobs(kind, user_id, payload, state) VALUES($1, $2, $3, $4) RETURNING id"
+	err := conn.QueryRow(context.Background(), statement, job.Kind, userID, string(job.Payload), JobQueued).Scan(&id)
+	return id, err
+}
+
+// LeaseJob marks the oldest queued job of a kind that is due as running and returns it.
+// Returns ErrNoJob if there is no queued job of that kind.  Jobs are locked while leased so concurrent workers never lease the same job.
+func LeaseJob(conn *pgxpool.Pool, kind string) (*Job, error) {
+	var job Job
+	statement := `UPDATE jobs SET state=$1, attempts=attempts+1, updated_at=now()
+		WHERE id=(SELECT id FROM jobs WHERE kind=$2 AND state=$3 AND run_after<=now() ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING id, kind, payload, state, attempts, last_error, checkpoint, run_after, created_at, updated_at`
+	err := conn.QueryRow(context.Background(), statement, JobRunning, kind, JobQueued).Scan(&job.ID, &job.Kind, &job.Payload, &job.State, &job.Attempts, &job.LastError, &job.Checkpoint, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoJob
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CompleteJob marks a job as done.
+func CompleteJob(conn *pgxpool.Pool, ID int64) error {
+	statement := "UPDATE jobs SET state=$1, updated_at=now() WHERE id=$2"
+	_, err := conn.Exec(context.Background(), statement, JobDone, ID)
+	return err
+}
+
+// UpdateJobCheckpoint saves the progress of a running job.
+func UpdateJobCheckpoint(conn *pgxpool.Pool, ID int64, checkpoint string) error {
+	statement := "UPDATE jobs SET checkpoint=$1, updated_at=now() WHERE id=$2"
+	_, err := conn.Exec(context.Background(), statement, checkpoint, ID)
+	return err
+}
+
+// RetryJob puts a job that failed back in the queue, to be leased again after runAfter.  Its checkpoint is kept.
+func RetryJob(conn *pgxpool.Pool, ID int64, lastError string, runAfter time.Time) error {
+	statement := "UPDATE jobs SET state=$1, last_error=$2, run_after=$3, updated_at=now() WHERE id=$4"
+	_, err := conn.Exec(context.Background(), statement, JobQueued, lastError, runAfter, ID)
+	return err
+}
+
+// FailJob marks a job as permanently failed and records the error.  Failed jobs are the dead-letter list, they are never leased again unless requeued.
+func FailJob(conn *pgxpool.Pool, ID int64, lastError string) error {
+	statement := "UPDATE jobs SET state=$1, last_error=$2, updated_at=now() WHERE id=$3"
+	_, err := conn.Exec(context.Background(), statement, JobFailed, lastError, ID)
+	return err
+}
+
+// CancelJob marks a job as cancelled.  Cancelled jobs are never leased again.
+func CancelJob(conn *pgxpool.Pool, ID int64) error {
+	statement := "UPDATE jobs SET state=$1, updated_at=now() WHERE id=$2"
+	_, err := conn.Exec(context.Background(), statement, JobCancelled, ID)
+	return err
+}
+
+// CancelQueuedJob cancels a job if it is still queued.  Returns false if the job is not queued, for example because a worker leased it.
+func CancelQueuedJob(conn *pgxpool.Pool, ID int64) (bool, error) {
+	statement := "UPDATE jobs SET state=$1, updated_at=now() WHERE id=$2 AND state=$3"
+	tag, err := conn.Exec(context.Background(), statement, JobCancelled, ID, JobQueued)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DrainJobs cancels every queued job of a kind.  Running jobs are left alone.  Returns the number of cancelled jobs.
+func DrainJobs(conn *pgxpool.Pool, kind string) (int64, error) {
+	statement := "UPDATE jobs SET state=$1, updated_at=now() WHERE kind=$2 AND state=$3"
+	tag, err := conn.Exec(context.Background(), statement, JobCancelled, kind, JobQueued)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetActiveJobs returns up to limit running and queued jobs, running jobs first, then in the order they will be leased.
+func GetActiveJobs(conn *pgxpool.Pool, limit int) ([]Job, error) {
+	statement := `SELECT id, kind, payload, state, attempts, last_error, checkpoint, run_after, created_at, updated_at
+		FROM jobs WHERE state=$1 OR state=$2 ORDER BY state=$1 DESC, id LIMIT $3`
+	rows, err := conn.Query(context.Background(), statement, JobRunning, JobQueued, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		err = rows.Scan(&job.ID, &job.Kind, &job.Payload, &job.State, &job.Attempts, &job.LastError, &job.Checkpoint, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RequeueJob puts a single interrupted job back in the queue.  Its checkpoint is kept and the interrupted attempt is not counted.
+func RequeueJob(conn *pgxpool.Pool, ID int64) error {
+	statement := "UPDATE jobs SET state=$1, attempts=GREATEST(attempts-1, 0), updated_at=now() WHERE id=$2"
+	_, err := conn.Exec(context.Background(), statement, JobQueued, ID)
+	return err
+}
+
+// RequeueRunningJobs puts every running job back in the queue.  Only call this on startup, before any worker is started,
+// since jobs that are still running when the program stops were interrupted.  Returns the number of requeued jobs.
+func RequeueRunningJobs(conn *pgxpool.Pool) (int64, error) {
+	statement := "UPDATE jobs SET state=$1, updated_at=now() WHERE state=$2"
+	tag, err := conn.Exec(context.Background(), statement, JobQueued, JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CountJobs returns the number of jobs of a kind in a given state.
+func CountJobs(conn *pgxpool.Pool, kind string, state string) (int, error) {
+	var count int
+	statement := "SELECT COUNT(*) FROM jobs WHERE kind=$1 AND state=$2"
+	err := conn.QueryRow(context.Background(), statement, kind, state).Scan(&count)
+	return count, err
+}
+
+// CountCheckpointedJobs returns the number of queued jobs of a kind that have a checkpoint to resume from.
+func CountCheckpointedJobs(conn *pgxpool.Pool, kind string) (int, error) {
+	var count int
+	statement := "SELECT COUNT(*) FROM jobs WHERE kind=$1 AND state=$2 AND checkpoint<>''"
+	err := conn.QueryRow(context.Background(), statement, kind, JobQueued).Scan(&count)
+	return count, err
+}
+
+// JobError is the error of a single failed attempt of a job.
+type JobError struct {
+	ID        int64     `json:"id"`
+	JobID     int64     `json:"job_id"`
+	Attempt   int       `json:"attempt"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertJobError records the error of a failed attempt of a job.
+func InsertJobError(conn *pgxpool.Pool, jobError *JobError) error {
+	statement := "INSERT INTO job_errors(job_id, attempt, error) VALUES($1, $2, $3)"
+	_, err := conn.Exec(context.Background(), statement, jobError.JobID, jobError.Attempt, jobError.Error)
+	return err
+}
+
+// GetJobErrors returns the error history of a job, oldest first.
+func GetJobErrors(conn *pgxpool.Pool, jobID int64) ([]JobError, error) {
+	statement := "SELECT id, job_id, attempt, error, created_at FROM job_errors WHERE job_id=$1 ORDER BY id"
+	rows, err := conn.Query(context.Background(), statement, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobErrors []JobError
+	for rows.Next() {
+		var jobError JobError
+		err = rows.Scan(&jobError.ID, &jobError.JobID, &jobError.Attempt, &jobError.Error, &jobError.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		jobErrors = append(jobErrors, jobError)
+	}
+	return jobErrors, rows.Err()
+}
+
+// GetFailedJobs returns every permanently failed job, most recently failed first.
+func GetFailedJobs(conn *pgxpool.Pool) ([]Job, error) {
+	statement := `SELECT id, kind, payload, state, attempts, last_error, checkpoint, run_after, created_at, updated_at
+		FROM jobs WHERE state=$1 ORDER BY updated_at DESC`
+	rows, err := conn.Query(context.Background(), statement, JobFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		err = rows.Scan(&job.ID, &job.Kind, &job.Payload, &job.State, &job.Attempts, &job.LastError, &job.Checkpoint, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RequeueFailedJob puts a permanently failed job back in the queue with its attempts reset.  Its checkpoint and error history are kept.
+// Returns ErrNotFound if there is no failed job with that ID.
+func RequeueFailedJob(conn *pgxpool.Pool, ID int64) (*Job, error) {
+	var job Job
+	statement := `UPDATE jobs SET state=$1, attempts=0, run_after=now(), updated_at=now() WHERE id=$2 AND state=$3
+		RETURNING id, kind, payload, state, attempts, last_error, checkpoint, run_after, created_at, updated_at`
+	err := conn.QueryRow(context.Background(), statement, JobQueued, ID, JobFailed).Scan(&job.ID, &job.Kind, &job.Payload, &job.State, &job.Attempts, &job.LastError, &job.Checkpoint, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CountQueuedJobs returns the number of queued jobs of every kind that has any.
+func CountQueuedJobs(conn *pgxpool.Pool) (map[string]int, error) {
+	statement := "SELECT kind, COUNT(*) FROM jobs WHERE state=$1 GROUP BY kind"
+	rows, err := conn.Query(context.Background(), statement, JobQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		err = rows.Scan(&kind, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[kind] = count
+	}
+	return counts, rows.Err()
+}
+
+// UserJobActive checks if a user has a queued or running job of a kind.
+func UserJobActive(conn *pgxpool.Pool, kind string, userID int64) bool {
+	var exists bool
+	statement := "SELECT EXISTS(SELECT 1 FROM jobs WHERE kind=$1 AND user_id=$2 AND (state=$3 OR state=$4))"
+	err := conn.QueryRow(context.Background(), statement, kind, userID, JobQueued, JobRunning).Scan(&exists)
+	if err != nil {
+		return false
+	}
+	return exists
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// FollowLimits are the largest follower and following lists that are collected for a user, and the largest lists of the accounts around them
+// that are collected when their connections are scraped.  A nil limit is not set and falls back to a wider scope.
+type FollowLimits struct {
+	Followers   *int `json:"followers,omitempty"`
+	Followings  *int `json:"followings,omitempty"`
+	Connections *int `json:"connections,omitempty"`
+}
+
+// Empty reports whether none of the limits are set.
+func (l *FollowLimits) Empty() bool {
+	return l.Followers == nil && l.Followings == nil && l.Connections == nil
+}
+
+// Or returns the limits of l, with the limits that are not set taken from fallback.
+func (l FollowLimits) Or(fallback FollowLimits) FollowLimits {
+	if l.Followers == nil {
+		l.Followers = fallback.Followers
+	}
+	if l.Followings == nil {
+		l.Followings = fallback.Followings
+	}
+	if l.Connections == nil {
+		l.Connections = fallback.Connections
+	}
+	return l
+}
+
+// GetFollowLimits returns the follow limits of a user.  The limits of a participant override the limits of their cohort.
+// Users that are not participants, or have no limits set, get empty limits.
+func GetFollowLimits(conn *pgxpool.Pool, userID int64) (FollowLimits, error) {
+	var student, cohort FollowLimits
+	statement := `SELECT students.follower_limit, students.following_limit, students.connection_limit,
+		cohort_limits.follower_limit, cohort_limits.following_limit, cohort_limits.connection_limit
+		FROM students
+		LEFT JOIN cohort_limits ON cohort_limits.school_id=students.school_id AND cohort_limits.cohort=students.cohort
+		WHERE students.user_id=$1`
+	err := conn.QueryRow(context.Background(), statement, userID).Scan(&student.Followers, &student.Followings, &student.Connections,
+		&cohort.Followers, &cohort.Followings, &cohort.Connections)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return FollowLimits{}, nil
+	}
+	if err != nil {
+		return FollowLimits{}, err
+	}
+	return student.Or(cohort), nil
+}
+
+// SetStudentFollowLimits sets the follow limits of a participant.  Limits that are nil are cleared, so the cohort or global limit applies.
+func SetStudentFollowLimits(conn *pgxpool.Pool, userID int64, limits FollowLimits) error {
+	statement := "UPDATE students SET follower_limit=$1, following_limit=$2, connection_limit=$3 WHERE user_id=$4"
+	_, err := conn.Exec(context.Background(), statement, limits.Followers, limits.Followings, limits.Connections, userID)
+	return err
+}
+
+// GetCohortFollowLimits returns the follow limits of a cohort of a school.
+func GetCohortFollowLimits(conn *pgxpool.Pool, schoolID int, cohort int) (FollowLimits, error) {
+	var limits FollowLimits
+	statement := "SELECT follower_limit, following_limit, connection_limit FROM cohort_limits WHERE school_id=$1 AND cohort=$2"
+	err := conn.QueryRow(context.Background(), statement, schoolID, cohort).Scan(&limits.Followers, &limits.Followings, &limits.Connections)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return FollowLimits{}, nil
+	}
+	return limits, err
+}
+
+// SetCohortFollowLimits sets the follow limits of a cohort of a school.  Limits that are nil are cleared, so the global limit applies.
+func SetCohortFollowLimits(conn *pgxpool.Pool, schoolID int, cohort int, limits FollowLimits) error {
+	statement := `INSERT INTO cohort_limits(school_id, cohort, follower_limit, following_limit, connection_limit) VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (school_id, cohort) DO UPDATE SET follower_limit=$3, following_limit=$4, connection_limit=$5`
+	_, err := conn.Exec(context.Background(), statement, schoolID, cohort, limits.Followers, limits.Followings, limits.Connections)
+	return err
+}
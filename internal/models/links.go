@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// The types of media a tweet can have.
+const (
+	MediaPhoto = "photo"
+	MediaVideo = "video"
+)
+
+// TweetURL is a link shared in a tweet.  URL is the expanded link, not the t.co link, and Domain is its host name without "www.".
+type TweetURL struct {
+	ID      int64  `json:"id"`
+	TweetID int64  `json:"tweet_id"`
+	URL     string `json:"url"`
+	Domain  string `json:"domain"`
+}
+
+// TweetMedia is a photo or video attached to a tweet.  Preview is the still image of a video, and empty for photos.
+type TweetMedia struct {
+	ID      int64  `json:"id"`
+	TweetID int64  `json:"tweet_id"`
+	Type    string `json:"media_type"`
+	URL     string `json:"url"`
+	Preview string `json:"preview"`
+}
+
+// insertTweetURL adds a link of a tweet, a link that is already in the database is left alone.
+const insertTweetURL = "INSERT INTO tweet_urls(tweet_id, url, domain) VALUES($1, $2, $3) ON CONFLICT (tweet_id, url) DO NOTHING"
+
+// insertTweetMedia adds a photo or video of a tweet, media that is already in the database is left alone.
+const insertTweetMedia = "INSERT INTO tweet_media(tweet_id, media_type, url, preview) VALUES($1, $2, $3, $4) ON CONFLICT (tweet_id, url) DO NOTHING"
+
+// queueTweetLinks queues the links and media of a tweet on batch.
+func queueTweetLinks(batch *pgx.Batch, urls []*TweetURL, media []*TweetMedia) {
+	for _, url := range urls {
+		batch.Queue(insertTweetURL, url.TweetID, url.URL, url.Domain)
+	}
+	for _, item := range media {
+		batch.Queue(insertTweetMedia, item.TweetID, item.Type, item.URL, item.Preview)
+	}
+}
+
+// InsertTweetLinks inserts the links and media of tweets that are already in the database in a single batch.  Links and media that already exist are skipped.
+func InsertTweetLinks(conn *pgxpool.Pool, urls []*TweetURL, media []*TweetMedia) error {
+	batch := &pgx.Batch{}
+	queueTweetLinks(batch, urls, media)
+	return execBatch(conn, batch)
+}
+
+// DomainShare is how often the participants of a cohort shared links to a domain.  Tweets counts the tweets with a link to the domain,
+// Users the participants that posted them, and CohortTweets every tweet of the cohort with a counted link.
+type DomainShare struct {
+	SchoolID     int    `json:"school_id"`
+	School       string `json:"school"`
+	Cohort       int    `json:"cohort"`
+	Domain       string `json:"domain"`
+	Tweets       int    `json:"tweets"`
+	Users        int    `json:"users"`
+	CohortTweets int    `json:"cohort_tweets"`
+}
+
+// Share is the part of the tweets with links of the cohort that link to the domain.
+func (d DomainShare) Share() float64 {
+	if d.CohortTweets == 0 {
+		return 0
+	}
+	return float64(d.Tweets) / float64(d.CohortTweets)
+}
+
+// GetCohortDomains returns the domains the participants of each cohort link to most, at most limit per cohort, ordered by school and cohort
+// and then by how many tweets link to the domain.  Links to the domains in ignored are not counted.
+func GetCohortDomains(conn *pgxpool.Pool, limit int, ignored []string) ([]DomainShare, error) {
+	statement := `WITH shared AS (
+			SELECT students.school_id, students.cohort, tweet_urls.domain, tweet_urls.tweet_id, tweets.user_id
+			FROM tweet_urls JOIN tweets ON tweets.id=tweet_urls.tweet_id JOIN students ON students.user_id=tweets.user_id
+			WHERE tweet_urls.domain <> ALL($2)
+		), totals AS (
+			SELECT school_id, cohort, COUNT(DISTINCT tweet_id) AS tweets FROM shared GROUP BY school_id, cohort
+		), domains AS (
+			SELECT school_id, cohort, domain, COUNT(DISTINCT tweet_id) AS tweets, COUNT(DISTINCT user_id) AS users,
+				row_number() OVER (PARTITION BY school_id, cohort ORDER BY COUNT(DISTINCT tweet_id) DESC, domain) AS position
+			FROM shared GROUP BY school_id, cohort, domain
+		)
+		SELECT domains.school_id, COALESCE(schools.name, ''), domains.cohort, domains.domain, domains.tweets, domains.users, totals.tweets
+		FROM domains JOIN totals USING (school_id, cohort) JOIN schools ON schools.id=domains.school_id
+		WHERE domains.position <= $1
+		ORDER BY schools.name, domains.school_id, domains.cohort, domains.position`
+	rows, err := conn.Query(context.Background(), statement, limit, ignored)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []DomainShare
+	for rows.Next() {
+		var share DomainShare
+		err = rows.Scan(&share.SchoolID, &share.School, &share.Cohort, &share.Domain, &share.Tweets, &share.Users, &share.CohortTweets)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
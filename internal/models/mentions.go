@@ -1,44 +1,10 @@
 package models
 
-import (
-	"context"
-
-	"github.com/jackc/pgx/v4/pgxpool"
-)
-
 type Mention struct {
 	ID      int64 `json:"id"`
 	TweetID int64 `json:"tweet_id"`
 	UserID  int64 `json:"user_id"`
 }
 
-// InsertMention inserts a Mention object into the database.  No checking.
-func InsertMention(conn *pgxpool.Pool, mention *Mention) error {
-	if MentionExists(conn, mention) {
-		return nil
-	}
-	statement := "INSERT INTO mentions(tweet_id, user_id) VALUES($1, $2)"
-	_, err := conn.Exec(context.Background(), statement, mention.TweetID, mention.UserID)
-	return err
-}
-
-// GetMentionByTID returns a Mention object from the database if they exist.  Otherwise, it returns nil.
-// TODO: Return multiple mentions
-func GetMentionByTID(conn *pgxpool.Pool, ID int64) (Mention, error) {
-	var mention Mention
-	var err error
-	statement := "SELECT * FROM mentions WHERE tweet_id=$1"
-	err = conn.QueryRow(context.Background(), statement, ID).Scan(&mention.TweetID, &mention.UserID)
-	return mention, err
-}
-
-// MentionExists checks if a mention exists in the database.
-func MentionExists(conn *pgxpool.Pool, mention *Mention) bool {
-	var exists bool
-	statement := "SELECT EXISTS(SELECT 1 FROM mentions WHERE tweet_id=$1 AND user_id=$2)"
-	err := conn.QueryRow(context.Background(), statement, mention.TweetID, mention.UserID).Scan(&exists)
-	if err != nil {
-		return false
-	}
-	return exists
-}
+// insertMention adds a mention, a mention that is already in the database is left alone.
+const insertMention = "INSERT INTO mentions(tweet_id, user_id) VALUES($1, $2) ON CONFLICT (tweet_id, user_id) DO NOTHING"
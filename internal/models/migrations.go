@@ -0,0 +1,364 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// migration is a versioned change to the schema created by CreateTables.
+// Migrations are applied in order, and every migration is only ever applied once.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// migrations holds every schema change made after CreateTables.  Never edit or reorder a migration that has been released,
+// add a new one to the end instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "jobs",
+		statements: []string{
+			`create table jobs(
+				id bigserial primary key,
+				kind varchar(32) not null,
+				payload jsonb not null,
+				state varchar(16) not null,
+				attempts int not null default 0,
+				last_error text not null default '',
+				created_at timestamp not null default now(),
+				updated_at timestamp not null default now()
+			)`,
+			"CREATE INDEX jobs_kind_state ON jobs (kind, state, id)",
+			"DROP TABLE IF EXISTS follow_requests",
+			"DROP TABLE IF EXISTS follower_requests",
+			"DROP TABLE IF EXISTS connection_requests",
+		},
+	},
+	{
+		version: 2,
+		name:    "job checkpoints",
+		statements: []string{
+			"ALTER TABLE jobs ADD COLUMN checkpoint text not null default ''",
+		},
+	},
+	{
+		version: 3,
+		name:    "job retries",
+		statements: []string{
+			"ALTER TABLE jobs ADD COLUMN run_after timestamp not null default now()",
+			`create table job_errors(
+				id bigserial primary key,
+				job_id bigint not null references jobs(id) on delete cascade,
+				attempt int not null,
+				error text not null,
+				created_at timestamp not null default now()
+			)`,
+			"CREATE INDEX job_errors_job_id ON job_errors (job_id, id)",
+		},
+	},
+	{
+		version: 4,
+		name:    "schedules",
+		statements: []string{
+			"ALTER TABLE jobs ADD COLUMN user_id bigint",
+			"CREATE INDEX jobs_user_id ON jobs (user_id, kind, state)",
+			"ALTER TABLE students ADD COLUMN start_date timestamp",
+			`create table schedules(
+				id serial primary key,
+				school_id int references schools(id) ON DELETE CASCADE,
+				cohort int,
+				kind varchar(32) not null,
+				interval_hours int not null,
+				last_run_at timestamp,
+				next_run_at timestamp not null default now(),
+				last_enqueued int not null default 0,
+				last_skipped int not null default 0,
+				created_at timestamp not null default now()
+			)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "incremental tweets",
+		statements: []string{
+			"ALTER TABLE students ADD COLUMN end_date timestamp",
+			"CREATE INDEX tweets_user_id_posted_at ON tweets (user_id, posted_at)",
+		},
+	},
+	{
+		version: 6,
+		name:    "follow history",
+		statements: []string{
+			"ALTER TABLE follows ADD COLUMN first_seen timestamp",
+			"ALTER TABLE follows ADD COLUMN last_seen timestamp",
+			"ALTER TABLE follows ADD COLUMN ended_at timestamp",
+			"UPDATE follows SET first_seen=collected_at, last_seen=collected_at",
+			"CREATE INDEX follows_follower_id ON follows (follower_id, followee_id)",
+			"CREATE INDEX follows_followee_id ON follows (followee_id, follower_id)",
+			`create table follow_events(
+				id bigserial primary key,
+				follower_id bigint references users(id),
+				followee_id bigint references users(id),
+				event varchar(16) not null,
+				observed_at timestamp not null
+			)`,
+			"CREATE INDEX follow_events_follower_id ON follow_events (follower_id, observed_at)",
+			"CREATE INDEX follow_events_followee_id ON follow_events (followee_id, observed_at)",
+			`create table follow_snapshots(
+				id bigserial primary key,
+				user_id bigint references users(id),
+				direction varchar(16) not null,
+				started_at timestamp not null,
+				completed_at timestamp not null,
+				edges int not null
+			)`,
+			"CREATE INDEX follow_snapshots_user_id ON follow_snapshots (user_id, direction)",
+		},
+	},
+	{
+		version: 7,
+		name:    "user snapshots",
+		statements: []string{
+			`create table user_snapshots(
+				id bigserial primary key,
+				user_id bigint not null,
+				collected_at timestamp not null,
+				followers int,
+				following int,
+				tweets int,
+				likes int,
+				bio text,
+				location varchar(256),
+				verified boolean
+			)`,
+			"CREATE INDEX user_snapshots_user_id ON user_snapshots (user_id, collected_at)",
+			//the profile every user has now is their first snapshot
+			`INSERT INTO user_snapshots(user_id, collected_at, followers, following, tweets, likes, bio, location, verified)
+				SELECT id, COALESCE(collected_at, now()), followers, following, tweets, likes, bio, location, verified FROM users`,
+		},
+	},
+	{
+		version: 8,
+		name:    "handle history",
+		statements: []string{
+			`create table handle_history(
+				id bigserial primary key,
+				user_id bigint not null,
+				handle varchar(64) not null,
+				first_seen timestamp not null,
+				last_seen timestamp not null
+			)`,
+			"CREATE INDEX handle_history_handle ON handle_history (lower(handle))",
+			"CREATE INDEX handle_history_user_id ON handle_history (user_id)",
+			//the handle every user has now starts their history
+			"INSERT INTO handle_history(user_id, handle, first_seen, last_seen) SELECT id, handle, COALESCE(collected_at, now()), COALESCE(collected_at, now()) FROM users WHERE handle IS NOT NULL",
+		},
+	},
+	{
+		version: 9,
+		name:    "account states",
+		statements: []string{
+			"ALTER TABLE users ADD COLUMN account_state varchar(16) NOT NULL DEFAULT 'active'",
+			"ALTER TABLE users ADD COLUMN state_changed_at timestamp",
+		},
+	},
+	{
+		version: 10,
+		name:    "follow limits",
+		statements: []string{
+			"ALTER TABLE students ADD COLUMN follower_limit int",
+			"ALTER TABLE students ADD COLUMN following_limit int",
+			"ALTER TABLE students ADD COLUMN connection_limit int",
+			`create table cohort_limits(
+				school_id int references schools(id) ON DELETE CASCADE,
+				cohort int,
+				follower_limit int,
+				following_limit int,
+				connection_limit int,
+				primary key (school_id, cohort)
+			)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "follow sampling",
+		statements: []string{
+			"ALTER TABLE follows ADD COLUMN partial boolean NOT NULL DEFAULT false",
+			`create table follow_coverage(
+				user_id bigint not null,
+				direction varchar(16) not null,
+				collected int not null,
+				expected int not null,
+				ratio real not null,
+				partial boolean not null,
+				updated_at timestamp not null,
+				primary key (user_id, direction)
+			)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "unique constraints",
+		statements: []string{
+			//duplicates from before the constraints are dropped, the oldest row is kept
+			"DELETE FROM follows newer USING follows older WHERE newer.follower_id=older.follower_id AND newer.followee_id=older.followee_id AND newer.id > older.id",
+			"ALTER TABLE follows ADD CONSTRAINT follows_follower_id_followee_id_key UNIQUE (follower_id, followee_id)",
+			"DELETE FROM mentions newer USING mentions older WHERE newer.tweet_id=older.tweet_id AND newer.user_id=older.user_id AND newer.id > older.id",
+			"ALTER TABLE mentions ADD CONSTRAINT mentions_tweet_id_user_id_key UNIQUE (tweet_id, user_id)",
+			"DELETE FROM hashtags newer USING hashtags older WHERE newer.tag=older.tag AND newer.tweet_id=older.tweet_id AND newer.id > older.id",
+			"ALTER TABLE hashtags ADD CONSTRAINT hashtags_tag_tweet_id_key UNIQUE (tag, tweet_id)",
+			"DELETE FROM bio_tags newer USING bio_tags older WHERE newer.user_id=older.user_id AND newer.mentioned_user_id=older.mentioned_user_id AND newer.id > older.id",
+			"ALTER TABLE bio_tags ADD CONSTRAINT bio_tags_user_id_mentioned_user_id_key UNIQUE (user_id, mentioned_user_id)",
+		},
+	},
+	{
+		version: 13,
+		name:    "quote tweets",
+		statements: []string{
+			"ALTER TABLE tweets ADD COLUMN retweeted_tweet_id bigint references tweets(id) ON DELETE CASCADE",
+			"ALTER TABLE tweets ADD COLUMN quoted_tweet_id bigint references tweets(id) ON DELETE CASCADE",
+			"ALTER TABLE tweets ADD COLUMN tweet_type varchar(16) NOT NULL DEFAULT 'tweet'",
+			//retweet_id held the retweeted tweet of retweets and the quoted tweet of every other tweet
+			"UPDATE tweets SET retweeted_tweet_id=retweet_id WHERE is_retweet",
+			"UPDATE tweets SET quoted_tweet_id=retweet_id WHERE NOT is_retweet",
+			`UPDATE tweets SET tweet_type=CASE
+				WHEN is_retweet THEN 'retweet'
+				WHEN quoted_tweet_id IS NOT NULL THEN 'quote'
+				WHEN conversation_id<>id OR EXISTS(SELECT 1 FROM replies WHERE replies.tweet_id=tweets.id) THEN 'reply'
+				ELSE 'tweet' END`,
+			"ALTER TABLE tweets DROP COLUMN retweet_id",
+			"CREATE INDEX tweets_retweeted_tweet_id ON tweets (retweeted_tweet_id)",
+			"CREATE INDEX tweets_quoted_tweet_id ON tweets (quoted_tweet_id)",
+		},
+	},
+	{
+		version: 14,
+		name:    "reply threads",
+		statements: []string{
+			"ALTER TABLE replies ADD COLUMN parent_tweet_id bigint references tweets(id) ON DELETE CASCADE",
+			"DELETE FROM replies newer USING replies older WHERE newer.tweet_id=older.tweet_id AND newer.id > older.id",
+			"ALTER TABLE replies ADD CONSTRAINT replies_tweet_id_key UNIQUE (tweet_id)",
+			//conversation_id held the tweet a reply replied to, which becomes its parent
+			`UPDATE replies SET parent_tweet_id=tweets.conversation_id FROM tweets
+				WHERE tweets.id=replies.tweet_id AND tweets.conversation_id<>tweets.id`,
+			`INSERT INTO replies(tweet_id, user_replied_to_id, parent_tweet_id)
+				SELECT tweets.id, parent.user_id, parent.id FROM tweets JOIN tweets parent ON parent.id=tweets.conversation_id
+				WHERE tweets.conversation_id<>tweets.id
+				ON CONFLICT (tweet_id) DO NOTHING`,
+			"CREATE INDEX replies_parent_tweet_id ON replies (parent_tweet_id)",
+			//conversation_id becomes the root of the thread, the first tweet up the chain of parents that is not a reply
+			`WITH RECURSIVE roots AS (
+				SELECT id, id AS root FROM tweets WHERE conversation_id=id OR conversation_id IS NULL
+				UNION ALL
+				SELECT tweets.id, roots.root FROM tweets JOIN roots ON tweets.conversation_id=roots.id WHERE tweets.conversation_id<>tweets.id
+			)
+			UPDATE tweets SET conversation_id=roots.root FROM roots WHERE tweets.id=roots.id AND tweets.conversation_id<>roots.root`,
+		},
+	},
+	{
+		version: 15,
+		name:    "tweet urls and media",
+		statements: []string{
+			`create table tweet_urls(
+				id bigserial primary key,
+				tweet_id bigint not null references tweets(id) ON DELETE CASCADE,
+				url text not null,
+				domain varchar(256) not null,
+				UNIQUE (tweet_id, url)
+			)`,
+			"CREATE INDEX tweet_urls_domain ON tweet_urls (domain)",
+			`create table tweet_media(
+				id bigserial primary key,
+				tweet_id bigint not null references tweets(id) ON DELETE CASCADE,
+				media_type varchar(16) not null,
+				url text not null,
+				preview text not null default '',
+				UNIQUE (tweet_id, url)
+			)`,
+		},
+	},
+	{
+		version: 16,
+		name:    "tweet scores",
+		statements: []string{
+			`create table tweet_scores(
+				tweet_id bigint primary key references tweets(id) ON DELETE CASCADE,
+				sentiment double precision not null,
+				toxicity double precision not null,
+				toxic_words int not null,
+				words int not null,
+				scored_at timestamp not null
+			)`,
+		},
+	},
+	{
+		version: 17,
+		name:    "tweets collected until",
+		statements: []string{
+			"ALTER TABLE students ADD COLUMN tweets_collected_until timestamp",
+			//the newest stored tweet was the lower bound of the next tweets job until now
+			"UPDATE students SET tweets_collected_until=(SELECT MAX(posted_at) FROM tweets WHERE tweets.user_id=students.user_id)",
+		},
+	},
+	{
+		version: 18,
+		name:    "video preview photos",
+		statements: []string{
+			//the preview of every video was stored as a photo of its tweet too
+			`DELETE FROM tweet_media photo WHERE photo.media_type='photo' AND EXISTS(
+				SELECT 1 FROM tweet_media video WHERE video.tweet_id=photo.tweet_id AND video.media_type='video' AND video.preview=photo.url)`,
+		},
+	},
+}
+
+// Migrate applies every migration that has not been applied to the database yet.
+// CreateTables must have been run on the database at least once before.
+func Migrate(conn *pgxpool.Pool) error {
+	statement := `create table if not exists schema_migrations(
+		version int primary key,
+		name varchar(256),
+		applied_at timestamp
+		)`
+	_, err := conn.Exec(context.Background(), statement)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		var applied bool
+		statement = "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version=$1)"
+		err = conn.QueryRow(context.Background(), statement, m.version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		//every migration is applied in its own transaction so a failed migration leaves the schema untouched
+		tx, err := conn.Begin(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, statement := range m.statements {
+			_, err = tx.Exec(context.Background(), statement)
+			if err != nil {
+				tx.Rollback(context.Background())
+				return err
+			}
+		}
+		_, err = tx.Exec(context.Background(), "INSERT INTO schema_migrations(version, name, applied_at) VALUES($1, $2, now())", m.version, m.name)
+		if err != nil {
+			tx.Rollback(context.Background())
+			return err
+		}
+		err = tx.Commit(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
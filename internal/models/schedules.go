@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Schedule re-queues a kind of job for the participants of a school and cohort every IntervalHours.
+// A nil SchoolID or Cohort matches every school or cohort.  LastEnqueued and LastSkipped count the participants of the last run,
+// participants are skipped while they still have a job of the same kind queued or running.
+type Schedule struct {
+	ID            int        `json:"id"`
+	SchoolID      *int       `json:"school_id"`
+	SchoolName    string     `json:"school_name"`
+	Cohort        *int       `json:"cohort"`
+	Kind          string     `json:"kind"`
+	IntervalHours int        `json:"interval_hours"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+	NextRunAt     time.Time  `json:"next_run_at"`
+	LastEnqueued  int        `json:"last_enqueued"`
+	LastSkipped   int        `json:"last_skipped"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// InsertSchedule inserts a Schedule into the database.  The first run is due straight away.
+func InsertSchedule(conn *pgxpool.Pool, schedule *Schedule) error {
+	statement := "INSERT INTO schedules(school_id, cohort, kind, interval_hours) VALUES($1, $2, $3, $4)"
+	_, err := conn.Exec(context.Background(), statement, schedule.SchoolID, schedule.Cohort, schedule.Kind, schedule.IntervalHours)
+	return err
+}
+
+// DeleteSchedule deletes a Schedule from the database.
+func DeleteSchedule(conn *pgxpool.Pool, ID int) error {
+	statement := "DELETE FROM schedules WHERE id=$1"
+	_, err := conn.Exec(context.Background(), statement, ID)
+	return err
+}
+
+// GetAllSchedules returns every Schedule in the database, with the name of its school.
+func GetAllSchedules(conn *pgxpool.Pool) ([]Schedule, error) {
+	return getSchedules(conn, "")
+}
+
+// GetDueSchedules returns every Schedule whose next run is due.
+func GetDueSchedules(conn *pgxpool.Pool) ([]Schedule, error) {
+	return getSchedules(conn, "WHERE schedules.next_run_at<=now()")
+}
+
+// getSchedules returns the schedules matching a where clause, ordered by ID.
+func getSchedules(conn *pgxpool.Pool, where string) ([]Schedule, error) {
+	statement := `SELECT schedules.id, schedules.school_id, COALESCE(schools.name, ''), schedules.cohort, schedules.kind, schedules.interval_hours,
+		schedules.last_run_at, schedules.next_run_at, schedules.last_enqueued, schedules.last_skipped, schedules.created_at
+		FROM schedules LEFT JOIN schools ON schools.id=schedules.school_id ` + where + " ORDER BY schedules.id"
+	rows, err := conn.Query(context.Background(), statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		var schedule Schedule
+		err = rows.Scan(&schedule.ID, &schedule.SchoolID, &schedule.SchoolName, &schedule.Cohort, &schedule.Kind, &schedule.IntervalHours,
+			&schedule.LastRunAt, &schedule.NextRunAt, &schedule.LastEnqueued, &schedule.LastSkipped, &schedule.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// MarkScheduleRun records a run of a Schedule and moves its next run one interval ahead.
+func MarkScheduleRun(conn *pgxpool.Pool, ID int, enqueued int, skipped int) error {
+	statement := `UPDATE schedules SET last_run_at=now(), next_run_at=now() + make_interval(hours => interval_hours),
+		last_enqueued=$1, last_skipped=$2 WHERE id=$3`
+	_, err := conn.Exec(context.Background(), statement, enqueued, skipped, ID)
+	return err
+}
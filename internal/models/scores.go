@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TweetScore is the sentiment and toxicity of a tweet.  Sentiment goes from -1, most negative, to 1, most positive.
+// Toxicity is the part of the words of the tweet that are on the toxicity word list, and ToxicWords how many of them there are.
+type TweetScore struct {
+	TweetID    int64     `json:"tweet_id"`
+	Sentiment  float64   `json:"sentiment"`
+	Toxicity   float64   `json:"toxicity"`
+	ToxicWords int       `json:"toxic_words"`
+	Words      int       `json:"words"`
+	ScoredAt   time.Time `json:"scored_at"`
+}
+
+// insertTweetScore adds the score of a tweet, or replaces it if the tweet was scored before.
+const insertTweetScore = `INSERT INTO tweet_scores(tweet_id, sentiment, toxicity, toxic_words, words, scored_at) VALUES($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (tweet_id) DO UPDATE SET sentiment=excluded.sentiment, toxicity=excluded.toxicity, toxic_words=excluded.toxic_words,
+	words=excluded.words, scored_at=excluded.scored_at`
+
+// queueTweetScore queues the score of a tweet on batch.
+func queueTweetScore(batch *pgx.Batch, score *TweetScore) {
+	batch.Queue(insertTweetScore, score.TweetID, score.Sentiment, score.Toxicity, score.ToxicWords, score.Words, score.ScoredAt)
+}
+
+// InsertTweetScores stores the scores of tweets in a single batch, replacing the scores of tweets that were scored before.
+func InsertTweetScores(conn *pgxpool.Pool, scores []*TweetScore) error {
+	batch := &pgx.Batch{}
+	for _, score := range scores {
+		queueTweetScore(batch, score)
+	}
+	return execBatch(conn, batch)
+}
+
+// GetTweetsToScore returns up to limit tweets with an ID above afterID, in order of ID, with only their ID and text.
+// Tweets that already have a score are left out unless rescore is set.
+func GetTweetsToScore(conn *pgxpool.Pool, afterID int64, limit int, rescore bool) ([]Tweet, error) {
+	statement := `SELECT id, COALESCE(text, '') FROM tweets
+		WHERE id > $1 AND ($3 OR NOT EXISTS(SELECT 1 FROM tweet_scores WHERE tweet_scores.tweet_id=tweets.id))
+		ORDER BY id LIMIT $2`
+	rows, err := conn.Query(context.Background(), statement, afterID, limit, rescore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tweets []Tweet
+	for rows.Next() {
+		var tweet Tweet
+		err = rows.Scan(&tweet.ID, &tweet.Text)
+		if err != nil {
+			return nil, err
+		}
+		tweets = append(tweets, tweet)
+	}
+	return tweets, rows.Err()
+}
+
+// ScoreAverage is the average score of a set of tweets.  ToxicTweets counts the tweets with at least one toxic word.
+type ScoreAverage struct {
+	Tweets      int     `json:"tweets"`
+	Sentiment   float64 `json:"sentiment"`
+	Toxicity    float64 `json:"toxicity"`
+	ToxicTweets int     `json:"toxic_tweets"`
+}
+
+// ToxicShare is the part of the tweets with at least one toxic word.
+func (a ScoreAverage) ToxicShare() float64 {
+	if a.Tweets == 0 {
+		return 0
+	}
+	return float64(a.ToxicTweets) / float64(a.Tweets)
+}
+
+// ParticipantScore is the average score of the tweets of a participant.
+type ParticipantScore struct {
+	UserID int64  `json:"user_id"`
+	Handle string `json:"handle"`
+	School string `json:"school"`
+	Cohort int    `json:"cohort"`
+	ScoreAverage
+}
+
+// CohortScore is the average score of the tweets of the participants of a cohort.  Every tweet counts the same,
+// so participants that tweet more weigh more.
+type CohortScore struct {
+	SchoolID     int    `json:"school_id"`
+	School       string `json:"school"`
+	Cohort       int    `json:"cohort"`
+	Participants int    `json:"participants"`
+	ScoreAverage
+}
+
+// scoreAverageColumns selects a ScoreAverage from tweets joined with tweet_scores.
+const scoreAverageColumns = `COUNT(*), COALESCE(AVG(tweet_scores.sentiment), 0), COALESCE(AVG(tweet_scores.toxicity), 0),
+	COUNT(*) FILTER (WHERE tweet_scores.toxic_words > 0)`
+
+// GetUserScoreAverage returns the average score of the scored tweets a user wrote.  Retweets are left out, since their text is someone else's.
+func GetUserScoreAverage(conn *pgxpool.Pool, userID int64) (ScoreAverage, error) {
+	var average ScoreAverage
+	statement := "SELECT " + scoreAverageColumns + ` FROM tweets JOIN tweet_scores ON tweet_scores.tweet_id=tweets.id
+		WHERE tweets.user_id=$1 AND tweets.tweet_type<>'retweet'`
+	err := conn.QueryRow(context.Background(), statement, userID).Scan(&average.Tweets, &average.Sentiment, &average.Toxicity, &average.ToxicTweets)
+	return average, err
+}
+
+// GetParticipantScores returns the average score of the scored tweets of every participant that has any, ordered by school, cohort and handle.
+// Retweets are left out.
+func GetParticipantScores(conn *pgxpool.Pool) ([]ParticipantScore, error) {
+	statement := "SELECT users.id, users.handle, COALESCE(schools.name, ''), students.cohort, " + scoreAverageColumns + `
+		FROM students JOIN users ON users.id=students.user_id JOIN schools ON schools.id=students.school_id
+		JOIN tweets ON tweets.user_id=users.id AND tweets.tweet_type<>'retweet' JOIN tweet_scores ON tweet_scores.tweet_id=tweets.id
+		GROUP BY users.id, users.handle, schools.name, students.cohort
+		ORDER BY schools.name, students.cohort, lower(users.handle)`
+	rows, err := conn.Query(context.Background(), statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []ParticipantScore
+	for rows.Next() {
+		var score ParticipantScore
+		err = rows.Scan(&score.UserID, &score.Handle, &score.School, &score.Cohort, &score.Tweets, &score.Sentiment, &score.Toxicity, &score.ToxicTweets)
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
+
+// GetCohortScores returns the average score of the scored tweets of the participants of every cohort that has any, ordered by school and cohort.
+// Retweets are left out.
+func GetCohortScores(conn *pgxpool.Pool) ([]CohortScore, error) {
+	statement := "SELECT students.school_id, COALESCE(schools.name, ''), students.cohort, COUNT(DISTINCT students.user_id), " + scoreAverageColumns + `
+		FROM students JOIN schools ON schools.id=students.school_id
+		JOIN tweets ON tweets.user_id=students.user_id AND tweets.tweet_type<>'retweet' JOIN tweet_scores ON tweet_scores.tweet_id=tweets.id
+		GROUP BY students.school_id, schools.name, students.cohort
+		ORDER BY schools.name, students.school_id, students.cohort`
+	rows, err := conn.Query(context.Background(), statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []CohortScore
+	for rows.Next() {
+		var score CohortScore
+		err = rows.Scan(&score.SchoolID, &score.School, &score.Cohort, &score.Participants, &score.Tweets, &score.Sentiment, &score.Toxicity, &score.ToxicTweets)
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// UserSnapshot is the profile of a user as it was scraped at CollectedAt.  Users only hold the latest profile, snapshots keep every earlier one.
+type UserSnapshot struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	CollectedAt time.Time `json:"collected_at"`
+	Followers   int       `json:"followers"`
+	Following   int       `json:"following"`
+	Tweets      int       `json:"tweets"`
+	Likes       int       `json:"likes"`
+	Bio         string    `json:"bio"`
+	Location    string    `json:"location"`
+	Verified    bool      `json:"verified"`
+}
+
+// NewUserSnapshot returns a snapshot of the profile of a user.
+func NewUserSnapshot(user *User) *UserSnapshot {
+	snapshot := &UserSnapshot{
+		UserID:      user.ID,
+		CollectedAt: time.Now(),
+		Followers:   user.Followers,
+		Following:   user.Following,
+		Tweets:      user.Tweets,
+		Likes:       user.Likes,
+		Bio:         user.Bio,
+		Location:    user.Location,
+		Verified:    user.Verified,
+	}
+	if user.CollectedAt != nil {
+		snapshot.CollectedAt = *user.CollectedAt
+	}
+	return snapshot
+}
+
+// SameProfile reports whether two snapshots hold the same profile, regardless of when they were collected.
+func (s *UserSnapshot) SameProfile(other *UserSnapshot) bool {
+	return s.Followers == other.Followers && s.Following == other.Following && s.Tweets == other.Tweets && s.Likes == other.Likes &&
+		s.Bio == other.Bio && s.Location == other.Location && s.Verified == other.Verified
+}
+
+// InsertUserSnapshot inserts a UserSnapshot into the database.  If onlyChanged is set, the snapshot is skipped when it holds the same profile
+// as the latest snapshot of the user.  Returns whether the snapshot was inserted.
+func InsertUserSnapshot(conn *pgxpool.Pool, snapshot *UserSnapshot, onlyChanged bool) (bool, error) {
+	if onlyChanged {
+		latest, err := GetLatestUserSnapshot(conn, snapshot.UserID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return false, err
+		}
+		if latest != nil && latest.SameProfile(snapshot) {
+			return false, nil
+		}
+	}
+
+	statement := "INSERT INTO user_snapshots(user_id, collected_at, followers, following, tweets, likes, bio, location, verified) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	_, err := conn.Exec(context.Background(), statement, snapshot.UserID, snapshot.CollectedAt, snapshot.Followers, snapshot.Following, snapshot.Tweets, snapshot.Likes, snapshot.Bio, snapshot.Location, snapshot.Verified)
+	return err == nil, err
+}
+
+// GetLatestUserSnapshot returns the most recent snapshot of a user.  Returns ErrNotFound if the user has no snapshots.
+func GetLatestUserSnapshot(conn *pgxpool.Pool, userID int64) (*UserSnapshot, error) {
+	var snapshot UserSnapshot
+	statement := "SELECT id, user_id, collected_at, followers, following, tweets, likes, bio, location, verified FROM user_snapshots WHERE user_id=$1 ORDER BY collected_at DESC, id DESC LIMIT 1"
+	err := conn.QueryRow(context.Background(), statement, userID).Scan(&snapshot.ID, &snapshot.UserID, &snapshot.CollectedAt, &snapshot.Followers, &snapshot.Following, &snapshot.Tweets, &snapshot.Likes, &snapshot.Bio, &snapshot.Location, &snapshot.Verified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetUserSnapshots returns every snapshot of a user, oldest first.
+func GetUserSnapshots(conn *pgxpool.Pool, userID int64) ([]UserSnapshot, error) {
+	statement := "SELECT id, user_id, collected_at, followers, following, tweets, likes, bio, location, verified FROM user_snapshots WHERE user_id=$1 ORDER BY collected_at, id"
+	rows, err := conn.Query(context.Background(), statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []UserSnapshot
+	for rows.Next() {
+		var snapshot UserSnapshot
+		err = rows.Scan(&snapshot.ID, &snapshot.UserID, &snapshot.CollectedAt, &snapshot.Followers, &snapshot.Following, &snapshot.Tweets, &snapshot.Likes, &snapshot.Bio, &snapshot.Location, &snapshot.Verified)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
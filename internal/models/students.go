@@ -2,20 +2,27 @@ package models
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type Student struct {
-	SchoolID int   `json:"school_id"`
-	Cohort   int   `json:"cohort"`
-	UserID   int64 `json:"user_id"`
+	SchoolID  int        `json:"school_id"`
+	Cohort    int        `json:"cohort"`
+	UserID    int64      `json:"user_id"`
+	StartDate *time.Time `json:"start_date"`
+	EndDate   *time.Time `json:"end_date"`
+	//follow limits of the participant themselves, the limits of their cohort are not included
+	Limits FollowLimits `json:"limits"`
 }
 
 // InsertStudent inserts a Student object into the database.  No checking.
 func InsertStudent(conn *pgxpool.Pool, student *Student) error {
-	statement := "INSERT INTO students(school_id, cohort, user_id) VALUES($1, $2, $3)"
-	_, err := conn.Exec(context.Background(), statement, student.SchoolID, student.Cohort, student.UserID)
+	statement := "INSERT INTO students(school_id, cohort, user_id, start_date, end_date, follower_limit, following_limit, connection_limit) VALUES($1, $2, $3, $4, $5, $6, $7, $8)"
+	_, err := conn.Exec(context.Background(), statement, student.SchoolID, student.Cohort, student.UserID, student.StartDate, student.EndDate, student.Limits.Followers, student.Limits.Followings, student.Limits.Connections)
 	return err
 }
 
@@ -23,8 +30,8 @@ func InsertStudent(conn *pgxpool.Pool, student *Student) error {
 func GetStudentByID(conn *pgxpool.Pool, ID int64) (*Student, error) {
 	var student Student
 	var err error
-	statement := "SELECT * FROM students WHERE user_id=$1"
-	err = conn.QueryRow(context.Background(), statement, ID).Scan(&student.SchoolID, &student.UserID, &student.Cohort)
+	statement := "SELECT school_id, user_id, cohort, start_date, end_date, follower_limit, following_limit, connection_limit FROM students WHERE user_id=$1"
+	err = conn.QueryRow(context.Background(), statement, ID).Scan(&student.SchoolID, &student.UserID, &student.Cohort, &student.StartDate, &student.EndDate, &student.Limits.Followers, &student.Limits.Followings, &student.Limits.Connections)
 	return &student, err
 }
 
@@ -47,3 +54,70 @@ func StudentExists(conn *pgxpool.Pool, ID int64) bool {
 	}
 	return exists
 }
+
+// UpdateStudentDates updates the study window tweets of a student are collected in.  A nil endDate leaves the window open.
+func UpdateStudentDates(conn *pgxpool.Pool, ID int64, startDate time.Time, endDate *time.Time) error {
+	statement := "UPDATE students SET start_date=$1, end_date=$2 WHERE user_id=$3"
+	_, err := conn.Exec(context.Background(), statement, startDate, endDate, ID)
+	return err
+}
+
+// GetTweetsCollectedUntil returns the time up to which the timeline of a student was completely collected.  Returns nil if it never was.
+func GetTweetsCollectedUntil(conn *pgxpool.Pool, ID int64) (*time.Time, error) {
+	var until *time.Time
+	statement := "SELECT tweets_collected_until FROM students WHERE user_id=$1"
+	err := conn.QueryRow(context.Background(), statement, ID).Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return until, err
+}
+
+// SetTweetsCollectedUntil records that the timeline of a student was completely collected up to until.  It never moves back.
+func SetTweetsCollectedUntil(conn *pgxpool.Pool, ID int64, until time.Time) error {
+	statement := "UPDATE students SET tweets_collected_until=GREATEST(tweets_collected_until, $1) WHERE user_id=$2"
+	_, err := conn.Exec(context.Background(), statement, until, ID)
+	return err
+}
+
+// Participant is a student together with their handle, as needed to queue jobs for them.
+type Participant struct {
+	UserID    int64
+	Handle    string
+	SchoolID  int
+	Cohort    int
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// GetParticipants returns the students of a school and cohort.  A nil schoolID or cohort matches every school or cohort.
+// StartDate is the zero time for students that were added before start dates were stored, EndDate is the zero time if the study window is open.
+func GetParticipants(conn *pgxpool.Pool, schoolID *int, cohort *int) ([]Participant, error) {
+	statement := `SELECT students.user_id, users.handle, students.school_id, students.cohort, students.start_date, students.end_date
+		FROM students JOIN users ON users.id=students.user_id
+		WHERE ($1::int IS NULL OR students.school_id=$1) AND ($2::int IS NULL OR students.cohort=$2)
+		ORDER BY students.user_id`
+	rows, err := conn.Query(context.Background(), statement, schoolID, cohort)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []Participant
+	for rows.Next() {
+		var participant Participant
+		var startDate, endDate *time.Time
+		err = rows.Scan(&participant.UserID, &participant.Handle, &participant.SchoolID, &participant.Cohort, &startDate, &endDate)
+		if err != nil {
+			return nil, err
+		}
+		if startDate != nil {
+			participant.StartDate = *startDate
+		}
+		if endDate != nil {
+			participant.EndDate = *endDate
+		}
+		participants = append(participants, participant)
+	}
+	return participants, rows.Err()
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-var tables = []string{"users", "tweets", "schools", "students", "replies", "mentions", "bio_tags", "hashtags", "follows", "sessions", "admins", "follow_requests", "follower_requests", "connection_requests"}
+var tables = []string{"users", "tweets", "schools", "students", "replies", "mentions", "bio_tags", "hashtags", "tweet_urls", "tweet_media", "tweet_scores", "follows", "follow_events", "follow_snapshots", "user_snapshots", "handle_history", "cohort_limits", "follow_coverage", "sessions", "admins", "jobs", "job_errors", "schedules", "schema_migrations"}
 
 // DeleteTables drops all tables in the database.  Only use when testing or when you want to start from scratch.
 func DeleteTables(conn *pgxpool.Pool) error {
@@ -178,39 +178,6 @@ func CreateTables(conn *pgxpool.Pool) error {
 		return err
 	}
 
-	statement = `create table follow_requests(
-		id serial primary key,
-		user_id bigint,
-		username varchar(256),
-		scrape_connections boolean
-		)`
-	_, err = conn.Exec(context.Background(), statement)
-	if err != nil {
-		return err
-	}
-
-	statement = `create table follower_requests(
-		id serial primary key,
-		user_id bigint,
-		username varchar(256),
-		scrape_connections boolean
-		)`
-	_, err = conn.Exec(context.Background(), statement)
-	if err != nil {
-		return err
-	}
-
-	statement = `create table connection_requests(
-		id serial primary key,
-		user_id bigint,
-		username varchar(256),
-		follows_or_followers varchar(256)
-		)`
-	_, err = conn.Exec(context.Background(), statement)
-	if err != nil {
-		return err
-	}
-
 	statement = "CREATE INDEX sessions_expiry ON sessions (expiry)"
 	_, err = conn.Exec(context.Background(), statement)
 	if err != nil {
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ThreadTweet is a tweet in a conversation, with the handle of its author, the tweet it replies to and how deep in the conversation it is.
+// The root of the conversation has depth 0 and no parent.
+type ThreadTweet struct {
+	Tweet
+	Handle   string `json:"handle"`
+	ParentID *int64 `json:"parent_tweet_id"`
+	Depth    int    `json:"depth"`
+}
+
+// GetConversationID returns the conversation a tweet belongs to, which is the ID of the tweet at the root of its thread.
+func GetConversationID(conn *pgxpool.Pool, tweetID int64) (int64, error) {
+	var conversationID int64
+	statement := "SELECT conversation_id FROM tweets WHERE id=$1"
+	err := conn.QueryRow(context.Background(), statement, tweetID).Scan(&conversationID)
+	return conversationID, err
+}
+
+// GetConversation returns the thread rooted at a conversation ID, following the reply edges down from the root.
+// Tweets come depth first, so every tweet comes after its parent and before the tweets that reply to it, and replies to the same tweet are in the order they were posted.
+// Returns ErrNotFound if the root tweet is not in the database.
+func GetConversation(conn *pgxpool.Pool, conversationID int64) ([]ThreadTweet, error) {
+	statement := `WITH RECURSIVE thread AS (
+			SELECT id, NULL::bigint AS parent_id, 0 AS depth, ARRAY[id] AS path FROM tweets WHERE id=$1
+			UNION ALL
+			SELECT replies.tweet_id, replies.parent_tweet_id, thread.depth + 1, thread.path || replies.tweet_id
+			FROM replies JOIN thread ON replies.parent_tweet_id=thread.id
+		)
+		SELECT tweets.id, tweets.conversation_id, tweets.text, tweets.posted_at, tweets.url, tweets.user_id, tweets.is_retweet, tweets.retweeted_tweet_id,
+			tweets.quoted_tweet_id, tweets.tweet_type, tweets.likes, tweets.retweets, tweets.replies, tweets.collected_at, users.handle, thread.parent_id, thread.depth
+		FROM thread JOIN tweets ON tweets.id=thread.id JOIN users ON users.id=tweets.user_id
+		ORDER BY thread.path`
+	rows, err := conn.Query(context.Background(), statement, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var thread []ThreadTweet
+	for rows.Next() {
+		var tweet ThreadTweet
+		err = rows.Scan(&tweet.ID, &tweet.ConversationID, &tweet.Text, &tweet.PostedAt, &tweet.Url, &tweet.UserID, &tweet.IsRetweet, &tweet.RetweetedTweetID, &tweet.QuotedTweetID, &tweet.Type, &tweet.Likes, &tweet.Retweets, &tweet.Replies, &tweet.CollectedAt, &tweet.Handle, &tweet.ParentID, &tweet.Depth)
+		if err != nil {
+			return nil, err
+		}
+		thread = append(thread, tweet)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(thread) == 0 {
+		return nil, ErrNotFound
+	}
+	return thread, nil
+}
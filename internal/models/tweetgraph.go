@@ -0,0 +1,79 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TweetGraph is a tweet together with everything it refers to, stored as a single unit of work by SaveTweetGraph.
+// Referenced holds the graphs of the tweets it replies to, retweets or quotes, which are stored before it.
+// Authors are the users the graph needs that may not be in the database yet: the author of the tweet, the user it replies to
+// and the users it mentions.  Reply is the reply edge of the tweet, nil if it is not a reply.  URLs and Media are the links and attachments of the tweet,
+// and Score its sentiment and toxicity, nil if it is not scored.
+type TweetGraph struct {
+	Tweet      *Tweet
+	Referenced []*TweetGraph
+	Authors    []*User
+	Hashtags   []*Hashtag
+	Mentions   []*Mention
+	Reply      *Reply
+	URLs       []*TweetURL
+	Media      []*TweetMedia
+	Score      *TweetScore
+}
+
+// SaveTweetGraph stores a tweet graph in a single transaction, so either the tweet is stored with all of its references, hashtags,
+// mentions, reply edge, links, media and score, or nothing is.  Users, tweets, hashtags, mentions, replies, links and media that are already in the database are kept,
+// tweets only have their engagement updated.
+func SaveTweetGraph(conn *pgxpool.Pool, graph *TweetGraph) error {
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = saveTweetGraph(tx, graph)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// saveTweetGraph stores a tweet graph inside tx.  Every row is stored after the rows it references.
+func saveTweetGraph(tx pgx.Tx, graph *TweetGraph) error {
+	for _, author := range graph.Authors {
+		_, err := tx.Exec(context.Background(), insertUser, insertUserArgs(author)...)
+		if err != nil {
+			return err
+		}
+	}
+	for _, referenced := range graph.Referenced {
+		err := saveTweetGraph(tx, referenced)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(context.Background(), insertTweet, insertTweetArgs(graph.Tweet)...)
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	for _, hashtag := range graph.Hashtags {
+		batch.Queue(insertHashtag, hashtag.Hashtag, hashtag.TweetID)
+	}
+	for _, mention := range graph.Mentions {
+		batch.Queue(insertMention, mention.TweetID, mention.UserID)
+	}
+	if graph.Reply != nil {
+		batch.Queue(insertReply, graph.Reply.TweetID, graph.Reply.ReplyID, graph.Reply.ParentTweetID)
+	}
+	queueTweetLinks(batch, graph.URLs, graph.Media)
+	if graph.Score != nil {
+		queueTweetScore(batch, graph.Score)
+	}
+	return execBatch(tx, batch)
+}
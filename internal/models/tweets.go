@@ -2,45 +2,95 @@ package models
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// Tweet types.  A tweet has a single type even if it is more than one of them, e.g. a reply that quotes a tweet is a quote.
+// A retweet wins over a quote, which wins over a reply.
+const (
+	TweetOriginal = "tweet"
+	TweetReply    = "reply"
+	TweetQuote    = "quote"
+	TweetRetweet  = "retweet"
+)
+
+// Tweet is a tweet.  RetweetedTweetID and QuotedTweetID are the tweets it retweets and quotes, nil if it does not.
 type Tweet struct {
-	ID             int64      `json:"id"`
-	ConversationID int64      `json:"conversation_id"`
-	Text           string     `json:"text"`
-	PostedAt       *time.Time `json:"posted_at"`
-	Url            string     `json:"url"`
-	UserID         int64      `json:"user_id"`
-	IsRetweet      bool       `json:"is_retweet"`
-	RetweetID      *int64     `json:"retweet_id"`
-	Likes          int        `json:"likes"`
-	Retweets       int        `json:"retweets"`
-	Replies        int        `json:"replies"`
-	CollectedAt    *time.Time `json:"collected_at"`
-}
-
-// InsertTweet inserts a Tweet object into the database.
-func InsertTweet(conn *pgxpool.Pool, tweet *Tweet) error {
-	if TweetExists(conn, tweet.ID) {
-		return nil
+	ID               int64      `json:"id"`
+	ConversationID   int64      `json:"conversation_id"`
+	Text             string     `json:"text"`
+	PostedAt         *time.Time `json:"posted_at"`
+	Url              string     `json:"url"`
+	UserID           int64      `json:"user_id"`
+	IsRetweet        bool       `json:"is_retweet"`
+	RetweetedTweetID *int64     `json:"retweeted_tweet_id"`
+	QuotedTweetID    *int64     `json:"quoted_tweet_id"`
+	Type             string     `json:"tweet_type"`
+	Likes            int        `json:"likes"`
+	Retweets         int        `json:"retweets"`
+	Replies          int        `json:"replies"`
+	CollectedAt      *time.Time `json:"collected_at"`
+}
+
+// TweetType returns the type of a tweet from what it is.
+func TweetType(isRetweet bool, isQuote bool, isReply bool) string {
+	switch {
+	case isRetweet:
+		return TweetRetweet
+	case isQuote:
+		return TweetQuote
+	case isReply:
+		return TweetReply
+	}
+	return TweetOriginal
+}
+
+// tweetColumns are the columns of the tweets table read into a Tweet, in the order they are scanned.
+const tweetColumns = "id, conversation_id, text, posted_at, url, user_id, is_retweet, retweeted_tweet_id, quoted_tweet_id, tweet_type, likes, retweets, replies, collected_at"
+
+// scanTweet reads a row of tweetColumns into a tweet.
+func scanTweet(row pgx.Row, tweet *Tweet) error {
+	return row.Scan(&tweet.ID, &tweet.ConversationID, &tweet.Text, &tweet.PostedAt, &tweet.Url, &tweet.UserID, &tweet.IsRetweet, &tweet.RetweetedTweetID, &tweet.QuotedTweetID, &tweet.Type, &tweet.Likes, &tweet.Retweets, &tweet.Replies, &tweet.CollectedAt)
+}
+
+// insertTweet adds a tweet.  A tweet that is already in the database only has its engagement updated.
+const insertTweet = `INSERT INTO tweets(` + tweetColumns + `) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	ON CONFLICT (id) DO UPDATE SET likes=EXCLUDED.likes, retweets=EXCLUDED.retweets, replies=EXCLUDED.replies, collected_at=EXCLUDED.collected_at`
+
+// insertTweetArgs returns the arguments of insertTweet for a tweet.  A tweet without a type is an original tweet.
+func insertTweetArgs(tweet *Tweet) []interface{} {
+	tweetType := tweet.Type
+	if tweetType == "" {
+		tweetType = TweetOriginal
 	}
-	statement := "INSERT INTO tweets(id, conversation_id, text, posted_at, url, user_id, is_retweet, retweet_id, likes, retweets, replies, collected_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)"
-	_, err := conn.Exec(context.Background(), statement, tweet.ID, tweet.ConversationID, tweet.Text, tweet.PostedAt, tweet.Url, tweet.UserID, tweet.IsRetweet, tweet.RetweetID, tweet.Likes, tweet.Retweets, tweet.Replies, tweet.CollectedAt)
+	return []interface{}{tweet.ID, tweet.ConversationID, tweet.Text, tweet.PostedAt, tweet.Url, tweet.UserID, tweet.IsRetweet, tweet.RetweetedTweetID, tweet.QuotedTweetID, tweetType, tweet.Likes, tweet.Retweets, tweet.Replies, tweet.CollectedAt}
+}
+
+// InsertTweet inserts a Tweet object into the database.  Tweets that already exist only have their engagement updated.
+func InsertTweet(conn *pgxpool.Pool, tweet *Tweet) error {
+	_, err := conn.Exec(context.Background(), insertTweet, insertTweetArgs(tweet)...)
 	return err
 }
 
 // GetTweet returns a Tweet object from the database if they exist.  Otherwise, it returns nil.
 func GetTweet(conn *pgxpool.Pool, ID int64) (*Tweet, error) {
 	var tweet Tweet
-	var err error
-	statement := "SELECT * FROM tweets WHERE id=$1"
-	err = conn.QueryRow(context.Background(), statement, ID).Scan(&tweet.ID, &tweet.ConversationID, &tweet.Text, &tweet.PostedAt, &tweet.Url, &tweet.UserID, &tweet.IsRetweet, &tweet.RetweetID, &tweet.Likes, &tweet.Retweets, &tweet.Replies, &tweet.CollectedAt)
+	statement := "SELECT " + tweetColumns + " FROM tweets WHERE id=$1"
+	err := scanTweet(conn.QueryRow(context.Background(), statement, ID), &tweet)
 	return &tweet, err
 }
 
+// UpdateTweetEngagement updates the likes, retweets and replies of a tweet that is already in the database.
+func UpdateTweetEngagement(conn *pgxpool.Pool, tweet *Tweet) error {
+	statement := "UPDATE tweets SET likes=$1, retweets=$2, replies=$3, collected_at=$4 WHERE id=$5"
+	_, err := conn.Exec(context.Background(), statement, tweet.Likes, tweet.Retweets, tweet.Replies, tweet.CollectedAt, tweet.ID)
+	return err
+}
+
 // TweetExists checks if a tweet exists in the database.
 func TweetExists(conn *pgxpool.Pool, ID int64) bool {
 	var exists bool
@@ -51,3 +101,95 @@ func TweetExists(conn *pgxpool.Pool, ID int64) bool {
 	}
 	return exists
 }
+
+// GetUserTweets returns the newest tweets of a user, newest first.
+func GetUserTweets(conn *pgxpool.Pool, userID int64, limit int) ([]Tweet, error) {
+	statement := "SELECT " + tweetColumns + " FROM tweets WHERE user_id=$1 ORDER BY posted_at DESC NULLS LAST LIMIT $2"
+	rows, err := conn.Query(context.Background(), statement, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tweets []Tweet
+	for rows.Next() {
+		var tweet Tweet
+		err = scanTweet(rows, &tweet)
+		if err != nil {
+			return nil, err
+		}
+		tweets = append(tweets, tweet)
+	}
+	return tweets, rows.Err()
+}
+
+// TweetTypeCount is how many tweets of a type a user has in the database.
+type TweetTypeCount struct {
+	Type  string `json:"tweet_type"`
+	Count int    `json:"count"`
+}
+
+// GetTweetTypeCounts returns how many tweets of each type a user has in the database, most common type first.
+func GetTweetTypeCounts(conn *pgxpool.Pool, userID int64) ([]TweetTypeCount, error) {
+	statement := "SELECT tweet_type, count(*) FROM tweets WHERE user_id=$1 GROUP BY tweet_type ORDER BY count(*) DESC, tweet_type"
+	rows, err := conn.Query(context.Background(), statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TweetTypeCount
+	for rows.Next() {
+		var count TweetTypeCount
+		err = rows.Scan(&count.Type, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// TweetEdge is an edge of the retweet or quote network: how often a user retweeted or quoted the tweets of another user.
+type TweetEdge struct {
+	UserID   int64      `json:"user_id"`
+	Handle   string     `json:"handle"`
+	Count    int        `json:"count"`
+	LastTime *time.Time `json:"last_time"`
+}
+
+// tweetNetworkColumns maps the tweet types that form a network to the column that holds the tweet they point at.
+var tweetNetworkColumns = map[string]string{
+	TweetRetweet: "retweeted_tweet_id",
+	TweetQuote:   "quoted_tweet_id",
+}
+
+// GetTweetNetwork returns the users whose tweets a user retweeted (tweetType TweetRetweet) or quoted (tweetType TweetQuote),
+// with how often they did, most often first.  Replies that quote a tweet count as quotes.
+func GetTweetNetwork(conn *pgxpool.Pool, userID int64, tweetType string) ([]TweetEdge, error) {
+	column, ok := tweetNetworkColumns[tweetType]
+	if !ok {
+		return nil, fmt.Errorf("no network for tweets of type %q", tweetType)
+	}
+	statement := `SELECT users.id, users.handle, count(*), max(tweets.posted_at) FROM tweets
+		JOIN tweets referenced ON referenced.id=tweets.` + column + `
+		JOIN users ON users.id=referenced.user_id
+		WHERE tweets.user_id=$1
+		GROUP BY users.id, users.handle ORDER BY count(*) DESC, users.handle`
+	rows, err := conn.Query(context.Background(), statement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []TweetEdge
+	for rows.Next() {
+		var edge TweetEdge
+		err = rows.Scan(&edge.UserID, &edge.Handle, &edge.Count, &edge.LastTime)
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, edge)
+	}
+	return edges, rows.Err()
+}
@@ -25,26 +25,50 @@ type User struct {
 	Followers     int        `json:"followers"`
 	CollectedAt   *time.Time `json:"collected_at"`
 	IsParticipant bool       `json:"is_participant"`
+	//one of the Account constants, and when it last changed
+	AccountState   string     `json:"account_state"`
+	StateChangedAt *time.Time `json:"state_changed_at"`
 }
 
+// Account states of a user.  Only active and renamed accounts can be fully collected.
+const (
+	AccountActive    = "active"
+	AccountProtected = "protected"
+	AccountSuspended = "suspended"
+	AccountDeleted   = "deleted"
+	AccountRenamed   = "renamed"
+)
+
+// userColumns are the columns of the users table, in the order they are scanned into a User.
+const userColumns = "id, profile_name, handle, gender, is_person, joined, bio, location, verified, avatar, tweets, likes, media, following, followers, collected_at, is_participant, account_state, state_changed_at"
+
 var Format string = "2006-01-02"
 
-// InsertUser inserts a User object into the database.
-func InsertUser(conn *pgxpool.Pool, user *User) error {
-	if UserIDExists(conn, user.ID) {
-		return nil
+// insertUser adds a user, a user that is already in the database is left alone.  The arguments are the ones returned by insertUserArgs.
+const insertUser = "INSERT INTO users(id, profile_name, handle, gender, is_person, joined, bio, location, verified, avatar, tweets, likes, media, following, followers, collected_at, is_participant, account_state, state_changed_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, now()) ON CONFLICT (id) DO NOTHING"
+
+// insertUserArgs returns the arguments of insertUser for a user.  A user without an account state is active.
+func insertUserArgs(user *User) []interface{} {
+	state := user.AccountState
+	if state == "" {
+		state = AccountActive
 	}
-	statement := "INSERT INTO users(id, profile_name, handle, gender, is_person, joined, bio, location, verified, avatar, tweets, likes, media, following, followers, collected_at, is_participant) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)"
-	_, err := conn.Exec(context.Background(), statement, user.ID, user.ProfileName, user.Handle, user.Gender, user.IsPerson, user.Joined, user.Bio, user.Location, user.Verified, user.Avatar, user.Tweets, user.Likes, user.Media, user.Following, user.Followers, user.CollectedAt, user.IsParticipant)
+	return []interface{}{user.ID, user.ProfileName, user.Handle, user.Gender, user.IsPerson, user.Joined, user.Bio, user.Location, user.Verified, user.Avatar, user.Tweets, user.Likes, user.Media, user.Following, user.Followers, user.CollectedAt, user.IsParticipant, state}
+}
+
+// InsertUser inserts a User object into the database.  Users that already exist are skipped.
+func InsertUser(conn *pgxpool.Pool, user *User) error {
+	_, err := conn.Exec(context.Background(), insertUser, insertUserArgs(user)...)
 	return err
 }
 
 // GetUserByHandle returns a User object from the database if they exist.  Otherwise, it returns nil.
+// Handles the user had before they were renamed are resolved too.
 func GetUserByHandle(conn *pgxpool.Pool, handle string) (*User, error) {
 	var user User
 	var err error
-	statement := "SELECT * FROM users WHERE handle ILIKE $1"
-	err = conn.QueryRow(context.Background(), statement, handle).Scan(&user.ID, &user.ProfileName, &user.Handle, &user.Gender, &user.IsPerson, &user.Joined, &user.Bio, &user.Location, &user.Verified, &user.Avatar, &user.Tweets, &user.Likes, &user.Media, &user.Following, &user.Followers, &user.CollectedAt, &user.IsParticipant)
+	statement := "SELECT " + userColumns + " FROM users WHERE id=(" + resolveHandle + ")"
+	err = conn.QueryRow(context.Background(), statement, handle).Scan(&user.ID, &user.ProfileName, &user.Handle, &user.Gender, &user.IsPerson, &user.Joined, &user.Bio, &user.Location, &user.Verified, &user.Avatar, &user.Tweets, &user.Likes, &user.Media, &user.Following, &user.Followers, &user.CollectedAt, &user.IsParticipant, &user.AccountState, &user.StateChangedAt)
 	return &user, err
 }
 
@@ -52,15 +76,15 @@ func GetUserByHandle(conn *pgxpool.Pool, handle string) (*User, error) {
 func GetUserByID(conn *pgxpool.Pool, ID int64) (*User, error) {
 	var user User
 	var err error
-	statement := "SELECT * FROM users WHERE id=$1"
-	err = conn.QueryRow(context.Background(), statement, ID).Scan(&user.ID, &user.ProfileName, &user.Handle, &user.Gender, &user.IsPerson, &user.Joined, &user.Bio, &user.Location, &user.Verified, &user.Avatar, &user.Tweets, &user.Likes, &user.Media, &user.Following, &user.Followers, &user.CollectedAt, &user.IsParticipant)
+	statement := "SELECT " + userColumns + " FROM users WHERE id=$1"
+	err = conn.QueryRow(context.Background(), statement, ID).Scan(&user.ID, &user.ProfileName, &user.Handle, &user.Gender, &user.IsPerson, &user.Joined, &user.Bio, &user.Location, &user.Verified, &user.Avatar, &user.Tweets, &user.Likes, &user.Media, &user.Following, &user.Followers, &user.CollectedAt, &user.IsParticipant, &user.AccountState, &user.StateChangedAt)
 	return &user, err
 }
 
-// UserExists checks if a user exists in the database.
+// UserExists checks if a user exists in the database.  Handles the user had before they were renamed count too.
 func UserExists(conn *pgxpool.Pool, handle string) bool {
 	var exists bool
-	statement := "SELECT EXISTS(SELECT 1 FROM users WHERE handle ILIKE $1)"
+	statement := "SELECT EXISTS(" + resolveHandle + ")"
 	err := conn.QueryRow(context.Background(), statement, handle).Scan(&exists)
 	if err != nil {
 		return false
@@ -79,6 +103,25 @@ func UserIDExists(conn *pgxpool.Pool, ID int64) bool {
 	return exists
 }
 
+// UserIDsExist checks which of the given user IDs are in the database with a single query.  Every ID in the returned set exists.
+func UserIDsExist(conn *pgxpool.Pool, IDs []int64) (map[int64]bool, error) {
+	existing := make(map[int64]bool)
+	rows, err := conn.Query(context.Background(), "SELECT id FROM users WHERE id = ANY($1)", IDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ID int64
+		err = rows.Scan(&ID)
+		if err != nil {
+			return nil, err
+		}
+		existing[ID] = true
+	}
+	return existing, rows.Err()
+}
+
 func GetUsernameByID(conn *pgxpool.Pool, ID int64) (string, error) {
 	var username string
 	var err error
@@ -87,11 +130,11 @@ func GetUsernameByID(conn *pgxpool.Pool, ID int64) (string, error) {
 	return username, err
 }
 
-// GetUserIDByHandle returns the user's ID given their handle
+// GetUserIDByHandle returns the user's ID given their handle, or a handle they had before they were renamed
 func GetUserIDByHandle(conn *pgxpool.Pool, handle string) (int64, error) {
 	var id int64
 	var err error
-	statement := "SELECT id FROM users where handle ILIKE $1"
+	statement := resolveHandle
 	err = conn.QueryRow(context.Background(), statement, handle).Scan(&id)
 	if err != nil {
 		return 0, err
@@ -108,10 +151,26 @@ func UpdateUser(conn *pgxpool.Pool, user *User) error {
 }
 
 // UpdateUserHandle updates the user's handle given a user struct
+// The old and new handle are both recorded in the user's handle history, so the old handle still finds the user.
 func UpdateUserHandle(conn *pgxpool.Pool, user *User) error {
+	now := time.Now()
+	old, err := GetUsernameByID(conn, user.ID)
+	if err != nil {
+		return err
+	}
+	if old != user.Handle {
+		err = RecordHandle(conn, user.ID, old, now)
+		if err != nil {
+			return err
+		}
+	}
+
 	statement := "UPDATE users SET handle=$1 WHERE id=$2"
-	_, err := conn.Exec(context.Background(), statement, user.Handle, user.ID)
-	return err
+	_, err = conn.Exec(context.Background(), statement, user.Handle, user.ID)
+	if err != nil {
+		return err
+	}
+	return RecordHandle(conn, user.ID, user.Handle, now)
 }
 
 // GetAllUsernames returns a list of all usernames in the database.
@@ -139,7 +198,7 @@ func GetAllUsernames(conn *pgxpool.Pool) ([]string, error) {
 func GetAllParticipants(conn *pgxpool.Pool) ([]User, error) {
 	var users []User
 	var err error
-	statement := "SELECT * FROM users WHERE is_participant=TRUE"
+	statement := "SELECT " + userColumns + " FROM users WHERE is_participant=TRUE"
 	rows, err := conn.Query(context.Background(), statement)
 	if err != nil {
 		return nil, err
@@ -147,7 +206,7 @@ func GetAllParticipants(conn *pgxpool.Pool) ([]User, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var user User
-		err = rows.Scan(&user.ID, &user.ProfileName, &user.Handle, &user.Gender, &user.IsPerson, &user.Joined, &user.Bio, &user.Location, &user.Verified, &user.Avatar, &user.Tweets, &user.Likes, &user.Media, &user.Following, &user.Followers, &user.CollectedAt, &user.IsParticipant)
+		err = rows.Scan(&user.ID, &user.ProfileName, &user.Handle, &user.Gender, &user.IsPerson, &user.Joined, &user.Bio, &user.Location, &user.Verified, &user.Avatar, &user.Tweets, &user.Likes, &user.Media, &user.Following, &user.Followers, &user.CollectedAt, &user.IsParticipant, &user.AccountState, &user.StateChangedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -167,3 +226,27 @@ func GetUserCount(conn *pgxpool.Pool) (int, error) {
 	}
 	return count, nil
 }
+
+// SetAccountState sets the account state of a user.  state_changed_at is only moved when the state is different from the stored one.
+// Returns whether the state changed.
+func SetAccountState(conn *pgxpool.Pool, ID int64, state string) (bool, error) {
+	statement := "UPDATE users SET account_state=$1, state_changed_at=now() WHERE id=$2 AND account_state<>$1"
+	tag, err := conn.Exec(context.Background(), statement, state, ID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetAccountState returns the account state of a user.
+func GetAccountState(conn *pgxpool.Pool, ID int64) (string, error) {
+	var state string
+	statement := "SELECT account_state FROM users WHERE id=$1"
+	err := conn.QueryRow(context.Background(), statement, ID).Scan(&state)
+	return state, err
+}
+
+// AccountCollectable reports whether the followers, followings and tweets of an account in a state can be collected.
+func AccountCollectable(state string) bool {
+	return state == AccountActive || state == AccountRenamed || state == ""
+}
@@ -0,0 +1,289 @@
+// Package scoring scores the sentiment and toxicity of tweets offline, with word lists instead of a model or an outside service.
+package scoring
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The weights of the sentiment rules, the same as the ones VADER uses.
+const (
+	//added to the valence of a word for each booster before it, and taken off for each dampener
+	boosterIncrement = 0.293
+	//added to the valence of a word written in capitals in a text that is not all capitals
+	capsIncrement = 0.733
+	//multiplies the valence of a word that follows a negation
+	negationScalar = -0.74
+	//added to the sum of valences for each exclamation mark, up to maxExclamations
+	exclamationIncrement = 0.292
+	maxExclamations      = 4
+	//how quickly the compound score approaches -1 or 1 as valences add up
+	normalizationAlpha = 15
+)
+
+// negations turn the valence of the words that follow them around.  Any word that ends in "n't" is a negation too.
+var negations = map[string]bool{
+	"not": true, "no": true, "never": true, "none": true, "nobody": true, "nothing": true, "neither": true, "nor": true,
+	"nowhere": true, "cannot": true, "without": true, "aint": true, "dont": true, "doesnt": true, "didnt": true, "isnt": true,
+	"wasnt": true, "arent": true, "werent": true, "wont": true, "cant": true, "couldnt": true, "shouldnt": true, "wouldnt": true,
+}
+
+// boosters make the valence of the words that follow them stronger, or weaker when negative.
+var boosters = map[string]float64{
+	"absolutely": boosterIncrement, "amazingly": boosterIncrement, "completely": boosterIncrement, "especially": boosterIncrement,
+	"extremely": boosterIncrement, "highly": boosterIncrement, "incredibly": boosterIncrement, "really": boosterIncrement,
+	"so": boosterIncrement, "super": boosterIncrement, "totally": boosterIncrement, "truly": boosterIncrement, "very": boosterIncrement,
+	"most": boosterIncrement, "more": boosterIncrement, "hella": boosterIncrement, "deeply": boosterIncrement, "entirely": boosterIncrement,
+	"barely": -boosterIncrement, "hardly": -boosterIncrement, "kinda": -boosterIncrement, "slightly": -boosterIncrement,
+	"somewhat": -boosterIncrement, "marginally": -boosterIncrement, "partly": -boosterIncrement, "less": -boosterIncrement,
+	"little": -boosterIncrement, "occasionally": -boosterIncrement,
+}
+
+// Score is the sentiment and toxicity of a text.  Sentiment is the compound score from -1, most negative, to 1, most positive.
+// Toxicity is the part of the words of the text that are on the toxicity word list, ToxicWords how many of them there are,
+// and Words how many words the text has once links and mentions are left out.
+type Score struct {
+	Sentiment  float64
+	Toxicity   float64
+	ToxicWords int
+	Words      int
+}
+
+// Scorer scores texts with a sentiment lexicon and a toxicity word list.
+type Scorer struct {
+	lexicon map[string]float64
+	toxic   map[string]bool
+	//toxic words that end in "*" match any word they start
+	toxicPrefixes []string
+}
+
+// New creates a scorer from a lexicon of lower case words and their valence, and a list of toxic words.
+func New(lexicon map[string]float64, toxicWords []string) *Scorer {
+	scorer := &Scorer{
+		lexicon: lexicon,
+		toxic:   make(map[string]bool),
+	}
+	for _, word := range toxicWords {
+		word = strings.ToLower(word)
+		if strings.HasSuffix(word, "*") {
+			scorer.toxicPrefixes = append(scorer.toxicPrefixes, strings.TrimSuffix(word, "*"))
+		} else {
+			scorer.toxic[word] = true
+		}
+	}
+	return scorer
+}
+
+// Load creates a scorer from a lexicon file and a toxicity word list file.
+func Load(lexiconPath string, toxicPath string) (*Scorer, error) {
+	lexiconFile, err := os.Open(lexiconPath)
+	if err != nil {
+		return nil, err
+	}
+	defer lexiconFile.Close()
+	lexicon, err := ReadLexicon(lexiconFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", lexiconPath, err)
+	}
+
+	toxicFile, err := os.Open(toxicPath)
+	if err != nil {
+		return nil, err
+	}
+	defer toxicFile.Close()
+	toxicWords, err := ReadWordList(toxicFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", toxicPath, err)
+	}
+	return New(lexicon, toxicWords), nil
+}
+
+// ReadLexicon reads a lexicon with a word and its valence on each line, separated by a tab.  Any further columns are ignored,
+// so the lexicon VADER ships can be read as it is.  Empty lines and lines that start with "#" are skipped.
+func ReadLexicon(r io.Reader) (map[string]float64, error) {
+	lexicon := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a word and a valence separated by a tab", line)
+		}
+		valence, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		lexicon[strings.ToLower(strings.TrimSpace(fields[0]))] = valence
+	}
+	return lexicon, scanner.Err()
+}
+
+// ReadWordList reads a list with a word on each line.  Empty lines and lines that start with "#" are skipped.
+func ReadWordList(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		words = append(words, text)
+	}
+	return words, scanner.Err()
+}
+
+// token is a word of a text.  raw is the word as written, word the lower case word without the punctuation around it.
+type token struct {
+	raw  string
+	word string
+}
+
+// tokenize splits a text into words.  Links and mentions are left out, and the "#" of hashtags is dropped.
+func tokenize(text string) []token {
+	var tokens []token
+	for _, field := range strings.Fields(strings.ReplaceAll(text, "’", "'")) {
+		if strings.HasPrefix(field, "@") || strings.HasPrefix(field, "＠") || strings.Contains(field, "://") {
+			continue
+		}
+		trimmed := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if trimmed == "" {
+			//emoticons are kept as they are, they can be in the lexicon
+			tokens = append(tokens, token{raw: field, word: field})
+			continue
+		}
+		tokens = append(tokens, token{raw: trimmed, word: strings.ToLower(trimmed)})
+	}
+	return tokens
+}
+
+// Score scores the sentiment and toxicity of a text.
+func (s *Scorer) Score(text string) Score {
+	var score Score
+	tokens := tokenize(text)
+	shouting := allCaps(tokens)
+
+	//words before "but" count for half, the words after it for one and a half
+	but := -1
+	for i, token := range tokens {
+		if token.word == "but" {
+			but = i
+			break
+		}
+	}
+
+	sum := 0.0
+	for i, token := range tokens {
+		if unicode.IsLetter(firstRune(token.word)) || unicode.IsNumber(firstRune(token.word)) {
+			score.Words++
+			if s.isToxic(token.word) {
+				score.ToxicWords++
+			}
+		}
+
+		valence, ok := s.lexicon[token.word]
+		if !ok || valence == 0 {
+			continue
+		}
+		if !shouting && isCaps(token.raw) {
+			valence += math.Copysign(capsIncrement, valence)
+		}
+
+		negated := false
+		for distance := 1; distance <= 3 && i-distance >= 0; distance++ {
+			previous := tokens[i-distance].word
+			if boost, ok := boosters[previous]; ok {
+				//boosters further away count for less, and boost negative words the other way
+				boost *= 1 - 0.05*float64(distance-1)
+				if valence < 0 {
+					boost = -boost
+				}
+				valence += boost
+			}
+			if negations[previous] || strings.HasSuffix(previous, "n't") {
+				negated = true
+			}
+		}
+		if negated {
+			valence *= negationScalar
+		}
+
+		if but >= 0 {
+			if i < but {
+				valence *= 0.5
+			} else if i > but {
+				valence *= 1.5
+			}
+		}
+		sum += valence
+	}
+
+	if sum != 0 {
+		exclamations := math.Min(float64(strings.Count(text, "!")), maxExclamations)
+		sum += math.Copysign(exclamations*exclamationIncrement, sum)
+		score.Sentiment = sum / math.Sqrt(sum*sum+normalizationAlpha)
+	}
+	if score.Words > 0 {
+		score.Toxicity = float64(score.ToxicWords) / float64(score.Words)
+	}
+	return score
+}
+
+// isToxic checks a lower case word against the toxicity word list.
+func (s *Scorer) isToxic(word string) bool {
+	if s.toxic[word] {
+		return true
+	}
+	for _, prefix := range s.toxicPrefixes {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCaps checks if a word is written in capitals.  Single letters are not.
+func isCaps(word string) bool {
+	letters := 0
+	for _, r := range word {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			letters++
+		}
+	}
+	return letters > 1
+}
+
+// allCaps checks if every word of a text that has letters is written in capitals, in which case capitals do not add emphasis.
+func allCaps(tokens []token) bool {
+	for _, token := range tokens {
+		for _, r := range token.raw {
+			if unicode.IsLower(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// firstRune returns the first rune of a word, or 0 if it is empty.
+func firstRune(word string) rune {
+	for _, r := range word {
+		return r
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package scoring
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadLexicon(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name:  "words",
+			input: "good\t1.9\nBad\t-2.5\n",
+			want:  map[string]float64{"good": 1.9, "bad": -2.5},
+		},
+		{
+			//the lexicon VADER ships has the standard deviation and the ratings after the valence
+			name:  "extra columns",
+			input: "good\t1.9\t0.9434\t[2, 1, 2]\n",
+			want:  map[string]float64{"good": 1.9},
+		},
+		{
+			name:  "comments and empty lines",
+			input: "# valences\n\n:)\t2.0\n",
+			want:  map[string]float64{":)": 2.0},
+		},
+		{name: "no valence", input: "good 1.9\n", wantErr: true},
+		{name: "invalid valence", input: "good\thigh\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadLexicon(strings.NewReader(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadWordList(t *testing.T) {
+	got, err := ReadWordList(strings.NewReader("# toxic words\nidiot\n\n  stupid*  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"idiot", "stupid*"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// testScorer is the scorer the Score tests use.
+func testScorer() *Scorer {
+	return New(map[string]float64{"good": 1.9, "bad": -2.5, ":)": 2.0}, []string{"Idiot", "stupid*"})
+}
+
+func TestScoreSentiment(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want float64
+	}{
+		{name: "positive", text: "good", want: 1.9 / math.Sqrt(1.9*1.9+normalizationAlpha)},
+		{name: "negative", text: "bad", want: -2.5 / math.Sqrt(2.5*2.5+normalizationAlpha)},
+		{name: "no sentiment", text: "a table", want: 0},
+		{name: "emoticon", text: "nice day :)", want: 2.0 / math.Sqrt(2.0*2.0+normalizationAlpha)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testScorer().Score(tt.text).Sentiment
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score(%q).Sentiment = %f, want %f", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		baseline string
+		//whether the sentiment of text is stronger than the sentiment of baseline, in the same direction
+		stronger bool
+		//whether the sentiment of text has the opposite sign of the sentiment of baseline
+		flipped bool
+	}{
+		{name: "negation", text: "not good", baseline: "good", flipped: true},
+		{name: "contraction negation", text: "isn't good", baseline: "good", flipped: true},
+		{name: "negated negative", text: "not bad", baseline: "bad", flipped: true},
+		{name: "booster", text: "very good", baseline: "good", stronger: true},
+		{name: "booster on negative", text: "very bad", baseline: "bad", stronger: true},
+		{name: "dampener", text: "good", baseline: "slightly good", stronger: true},
+		{name: "dampener on negative", text: "bad", baseline: "slightly bad", stronger: true},
+		{name: "capitals", text: "GOOD day", baseline: "good day", stronger: true},
+		{name: "all capitals", text: "GOOD DAY", baseline: "good day"},
+		{name: "exclamation", text: "good!", baseline: "good", stronger: true},
+		{name: "but", text: "bad but good", baseline: "bad", flipped: true},
+	}
+	scorer := testScorer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scorer.Score(tt.text).Sentiment
+			baseline := scorer.Score(tt.baseline).Sentiment
+			switch {
+			case tt.flipped:
+				if got == 0 || math.Signbit(got) == math.Signbit(baseline) {
+					t.Errorf("Score(%q) = %f, want the opposite sign of Score(%q) = %f", tt.text, got, tt.baseline, baseline)
+				}
+			case tt.stronger:
+				if math.Signbit(got) != math.Signbit(baseline) || math.Abs(got) <= math.Abs(baseline) {
+					t.Errorf("Score(%q) = %f, want stronger than Score(%q) = %f", tt.text, got, tt.baseline, baseline)
+				}
+			default:
+				if math.Abs(got-baseline) > 1e-9 {
+					t.Errorf("Score(%q) = %f, want Score(%q) = %f", tt.text, got, tt.baseline, baseline)
+				}
+			}
+		})
+	}
+}
+
+func TestScoreToxicity(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		words      int
+		toxicWords int
+	}{
+		{name: "toxic word", text: "you idiot", words: 2, toxicWords: 1},
+		{name: "case and punctuation", text: "IDIOT!!", words: 1, toxicWords: 1},
+		{name: "prefix", text: "the stupidest thing", words: 3, toxicWords: 1},
+		{name: "hashtag", text: "#idiot of the day", words: 4, toxicWords: 1},
+		{name: "mentions and links left out", text: "@idiot see https://idiot.example.com now", words: 2, toxicWords: 0},
+		{name: "not toxic", text: "have a good day", words: 4, toxicWords: 0},
+		{name: "empty", text: "", words: 0, toxicWords: 0},
+	}
+	scorer := testScorer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := scorer.Score(tt.text)
+			if score.Words != tt.words || score.ToxicWords != tt.toxicWords {
+				t.Fatalf("Score(%q) has %d words and %d toxic words, want %d and %d", tt.text, score.Words, score.ToxicWords, tt.words, tt.toxicWords)
+			}
+			want := 0.0
+			if tt.words > 0 {
+				want = float64(tt.toxicWords) / float64(tt.words)
+			}
+			if score.Toxicity != want {
+				t.Errorf("Score(%q).Toxicity = %f, want %f", tt.text, score.Toxicity, want)
+			}
+		})
+	}
+}